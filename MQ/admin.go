@@ -0,0 +1,133 @@
+package MQ
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/orormaybe/RedisMQ/client"
+	"time"
+)
+
+// SeekResult 重置消费者组消费进度的结果
+type SeekResult struct {
+	// 重置前的 last-delivered-id
+	From string
+	// 重置后的 last-delivered-id
+	To string
+	// 向前重置时将被重新投递的消息数量
+	Redelivered int64
+	// 向后重置时将被跳过、不再投递的消息数量
+	Skipped int64
+}
+
+// Admin 消费者组运维操作
+type Admin struct {
+	client *client.Client
+}
+
+func NewAdmin(rc *client.Client) (*Admin, error) {
+	if rc == nil {
+		return nil, errors.New("redis client can't be empty")
+	}
+	return &Admin{client: rc}, nil
+}
+
+// SeekToID 将消费者组的消费进度重置到 id，之后组内从 id 之后的消息开始消费。
+// dryRun 为 true 时只统计将被重新投递或跳过的消息数量，不修改消费进度。
+// 注意：重置不会影响已投递但尚未 ack 的消息，它们仍然会被重试
+func (a *Admin) SeekToID(ctx context.Context, topic, groupID, id string, dryRun bool) (*SeekResult, error) {
+	if topic == "" || groupID == "" || id == "" {
+		return nil, errors.New("topic | group id | msg id can't be empty")
+	}
+	from, err := a.lastDeliveredID(ctx, topic, groupID)
+	if err != nil {
+		return nil, err
+	}
+	res := &SeekResult{From: from, To: id}
+	switch compareMsgID(id, from) {
+	case -1:
+		if res.Redelivered, err = a.count(ctx, topic, id, from); err != nil {
+			return nil, err
+		}
+	case 1:
+		if res.Skipped, err = a.count(ctx, topic, from, id); err != nil {
+			return nil, err
+		}
+	}
+	if dryRun {
+		return res, nil
+	}
+	if err := a.client.XGroupSetID(ctx, topic, groupID, id); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// SeekToTime 将消费者组的消费进度重置到 t，之后组内从 t 及之后投递的消息开始消费
+func (a *Admin) SeekToTime(ctx context.Context, topic, groupID string, t time.Time, dryRun bool) (*SeekResult, error) {
+	if topic == "" {
+		return nil, errors.New("topic can't be empty")
+	}
+	// 将进度设置为 t 之前的最后一条消息
+	msgs, err := a.client.XRevRange(ctx, topic, "("+msgIDFromTime(t), "-", 1)
+	if err != nil {
+		return nil, err
+	}
+	id := "0-0"
+	if len(msgs) > 0 {
+		id = msgs[0].MsgID
+	}
+	return a.SeekToID(ctx, topic, groupID, id, dryRun)
+}
+
+// SeekToBeginning 将消费者组的消费进度重置到最早的消息，之后组内重新消费 topic 中的所有消息
+func (a *Admin) SeekToBeginning(ctx context.Context, topic, groupID string, dryRun bool) (*SeekResult, error) {
+	return a.SeekToID(ctx, topic, groupID, "0-0", dryRun)
+}
+
+// SeekToEnd 将消费者组的消费进度重置到最新的消息，跳过所有尚未投递的消息
+func (a *Admin) SeekToEnd(ctx context.Context, topic, groupID string, dryRun bool) (*SeekResult, error) {
+	if topic == "" {
+		return nil, errors.New("topic can't be empty")
+	}
+	msgs, err := a.client.XRevRange(ctx, topic, "+", "-", 1)
+	if err != nil {
+		return nil, err
+	}
+	id := "0-0"
+	if len(msgs) > 0 {
+		id = msgs[0].MsgID
+	}
+	return a.SeekToID(ctx, topic, groupID, id, dryRun)
+}
+
+func (a *Admin) lastDeliveredID(ctx context.Context, topic, groupID string) (string, error) {
+	groups, err := a.client.XInfoGroups(ctx, topic)
+	if err != nil {
+		return "", err
+	}
+	for _, group := range groups {
+		if group.Name == groupID {
+			return group.LastDeliveredID, nil
+		}
+	}
+	return "", fmt.Errorf("consumer group not found, topic: %s, group id: %s", topic, groupID)
+}
+
+// 统计 id 位于 (from, to] 区间内的消息数量
+func (a *Admin) count(ctx context.Context, topic, from, to string) (int64, error) {
+	const batchSize = 1000
+	var cnt int64
+	start := "(" + from
+	for {
+		msgs, err := a.client.XRange(ctx, topic, start, to, batchSize)
+		if err != nil {
+			return 0, err
+		}
+		cnt += int64(len(msgs))
+		if len(msgs) < batchSize {
+			return cnt, nil
+		}
+		start = "(" + msgs[len(msgs)-1].MsgID
+	}
+}
@@ -0,0 +1,23 @@
+package MQ
+
+import (
+	"context"
+	"github.com/orormaybe/RedisMQ/client"
+	"testing"
+	"time"
+)
+
+func TestAdmin_SeekToTime(t *testing.T) {
+	c := client.NewClient(network, address, password)
+	admin, err := NewAdmin(c)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	res, err := admin.SeekToTime(context.Background(), topic, consumerGroup, time.Now().Add(-time.Hour), true)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	t.Logf("seek from %s to %s, redelivered: %d, skipped: %d", res.From, res.To, res.Redelivered, res.Skipped)
+}
@@ -0,0 +1,252 @@
+package MQ
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gomodule/redigo/redis"
+	"github.com/orormaybe/RedisMQ/client"
+	"github.com/orormaybe/RedisMQ/log"
+	"runtime/debug"
+	"time"
+)
+
+// BroadcastSubscriber 不经过消费者组，通过 XREAD 读取 topic 中的全部消息，每个实例都会收到每一条消息，适用于缓存失效通知等场景。
+// 消息处理失败时只记录日志，不会重试，也不需要 ack
+type BroadcastSubscriber struct {
+	client *client.Client
+	// 生命周期管理
+	ctx  context.Context
+	stop context.CancelFunc
+	// 订阅的 topic
+	topic string
+	// 接收到 msg 时执行的回调函数，由使用方定义
+	callbackFunc MsgCallback
+	// 最后一条已处理消息的 id
+	lastID string
+	opts   *BroadcastOptions
+	// 订阅流程退出时关闭
+	done chan struct{}
+}
+
+func NewBroadcastSubscriber(rc *client.Client, topic string, callbackFunc MsgCallback, opts ...BroadcastOption) (*BroadcastSubscriber, error) {
+	if rc == nil {
+		return nil, errors.New("redis client can't be empty")
+	}
+	if topic == "" {
+		return nil, errors.New("topic can't be empty")
+	}
+	if callbackFunc == nil {
+		return nil, errors.New("callback function can't be empty")
+	}
+	ctx, stop := context.WithCancel(context.Background())
+	s := &BroadcastSubscriber{
+		client:       rc,
+		ctx:          ctx,
+		stop:         stop,
+		topic:        topic,
+		callbackFunc: callbackFunc,
+		opts:         &BroadcastOptions{},
+		done:         make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(s.opts)
+	}
+	repairBroadcast(s.opts)
+	lastID, err := s.startID(ctx)
+	if err != nil {
+		stop()
+		return nil, err
+	}
+	s.lastID = lastID
+	go s.run()
+	return s, nil
+}
+
+func (s *BroadcastSubscriber) Stop() {
+	s.stop()
+}
+
+// Done 返回的 channel 在订阅流程退出时关闭
+func (s *BroadcastSubscriber) Done() <-chan struct{} {
+	return s.done
+}
+
+// 确定开始订阅的位置：优先使用 redis 中的检查点，其次使用指定的起始 id，否则只接收订阅之后的新消息
+func (s *BroadcastSubscriber) startID(ctx context.Context) (string, error) {
+	if s.opts.instanceID != "" {
+		lastID, err := s.client.Get(ctx, s.checkpointKey())
+		if err != nil && !errors.Is(err, redis.ErrNil) {
+			return "", err
+		}
+		if lastID != "" {
+			return lastID, nil
+		}
+	}
+	if s.opts.startID != "" {
+		return s.opts.startID, nil
+	}
+	// 不使用 "$"，避免两次 XREAD 之间投递的消息被漏掉
+	msgs, err := s.client.XRevRange(ctx, s.topic, "+", "-", 1)
+	if err != nil {
+		return "", err
+	}
+	if len(msgs) == 0 {
+		return "0-0", nil
+	}
+	return msgs[0].MsgID, nil
+}
+
+// 各实例的检查点，记录最后一条已处理消息的 id
+func (s *BroadcastSubscriber) checkpointKey() string {
+	return fmt.Sprintf("%s:broadcast:%s", s.topic, s.opts.instanceID)
+}
+
+func (s *BroadcastSubscriber) run() {
+	defer close(s.done)
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		default:
+		}
+		msgs, err := s.client.XRead(s.ctx, []string{s.topic}, []string{s.lastID}, s.opts.batchSize, int(s.opts.receiveTimeout.Milliseconds()))
+		if err != nil {
+			if errors.Is(err, client.ErrNoMsg) || s.ctx.Err() != nil {
+				continue
+			}
+			log.GetDefaultLogger().Errorf("broadcast receive failed, topic: %s, err: %v", s.topic, err)
+			select {
+			case <-s.ctx.Done():
+			case <-time.After(s.opts.receiveTimeout):
+			}
+			continue
+		}
+		for _, msg := range msgs {
+			s.handleMsg(msg)
+			s.lastID = msg.MsgID
+		}
+		s.checkpoint()
+	}
+}
+
+func (s *BroadcastSubscriber) handleMsg(msg *client.MsgEntity) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.GetDefaultLogger().Errorf("broadcast handle msg panic, topic: %s, msg id: %s, err: %v", s.topic, msg.MsgID, &PanicError{Value: r, Stack: debug.Stack()})
+		}
+	}()
+	if err := s.callbackFunc(s.ctx, msg); err != nil {
+		log.GetDefaultLogger().Errorf("broadcast handle msg failed, topic: %s, msg id: %s, err: %v", s.topic, msg.MsgID, err)
+	}
+}
+
+func (s *BroadcastSubscriber) checkpoint() {
+	if s.opts.instanceID == "" {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), s.opts.receiveTimeout)
+	defer cancel()
+	if _, err := s.client.Set(ctx, s.checkpointKey(), s.lastID); err != nil {
+		log.GetDefaultLogger().Errorf("broadcast checkpoint failed, topic: %s, instance id: %s, err: %v", s.topic, s.opts.instanceID, err)
+	}
+}
+
+// 通过 PUB/SUB 发布的消息体
+type pubSubMsg struct {
+	Key string `json:"key"`
+	Val string `json:"val"`
+}
+
+// Publish 通过 redis PUB/SUB 向 topic 发布消息，消息不会持久化，只有当前在线的订阅者能够收到，返回收到消息的订阅者数量
+func (p *Producer) Publish(ctx context.Context, topic, key, val string) (int64, error) {
+	if topic == "" {
+		return -1, errors.New("topic can't be empty")
+	}
+	data, err := json.Marshal(&pubSubMsg{Key: key, Val: val})
+	if err != nil {
+		return -1, err
+	}
+	return p.client.Publish(ctx, topic, data)
+}
+
+// PubSubSubscriber 通过 redis PUB/SUB 订阅 topic，消息即发即弃，断线期间发布的消息会丢失，收到的消息没有 MsgID。
+// 连接断开时自动重新订阅
+type PubSubSubscriber struct {
+	client *client.Client
+	// 生命周期管理
+	ctx  context.Context
+	stop context.CancelFunc
+	// 订阅的 topic
+	topic string
+	// 接收到 msg 时执行的回调函数，由使用方定义
+	callbackFunc MsgCallback
+	// 订阅流程退出时关闭
+	done chan struct{}
+}
+
+func NewPubSubSubscriber(rc *client.Client, topic string, callbackFunc MsgCallback) (*PubSubSubscriber, error) {
+	if rc == nil {
+		return nil, errors.New("redis client can't be empty")
+	}
+	if topic == "" {
+		return nil, errors.New("topic can't be empty")
+	}
+	if callbackFunc == nil {
+		return nil, errors.New("callback function can't be empty")
+	}
+	ctx, stop := context.WithCancel(context.Background())
+	s := &PubSubSubscriber{
+		client:       rc,
+		ctx:          ctx,
+		stop:         stop,
+		topic:        topic,
+		callbackFunc: callbackFunc,
+		done:         make(chan struct{}),
+	}
+	go s.run()
+	return s, nil
+}
+
+func (s *PubSubSubscriber) Stop() {
+	s.stop()
+}
+
+// Done 返回的 channel 在订阅流程退出时关闭
+func (s *PubSubSubscriber) Done() <-chan struct{} {
+	return s.done
+}
+
+func (s *PubSubSubscriber) run() {
+	defer close(s.done)
+	for {
+		err := s.client.Subscribe(s.ctx, []string{s.topic}, s.handleMsg)
+		if s.ctx.Err() != nil {
+			return
+		}
+		log.GetDefaultLogger().Errorf("pubsub subscribe failed, topic: %s, err: %v", s.topic, err)
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+func (s *PubSubSubscriber) handleMsg(channel string, data []byte) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.GetDefaultLogger().Errorf("pubsub handle msg panic, topic: %s, err: %v", channel, &PanicError{Value: r, Stack: debug.Stack()})
+		}
+	}()
+	var body pubSubMsg
+	if err := json.Unmarshal(data, &body); err != nil {
+		log.GetDefaultLogger().Errorf("pubsub invalid msg, topic: %s, err: %v", channel, err)
+		return
+	}
+	msg := &client.MsgEntity{Topic: channel, Key: body.Key, Val: body.Val}
+	if err := s.callbackFunc(s.ctx, msg); err != nil {
+		log.GetDefaultLogger().Errorf("pubsub handle msg failed, topic: %s, err: %v", channel, err)
+	}
+}
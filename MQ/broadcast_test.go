@@ -0,0 +1,23 @@
+package MQ
+
+import (
+	"context"
+	"github.com/orormaybe/RedisMQ/client"
+	"testing"
+	"time"
+)
+
+func TestBroadcastSubscriber(t *testing.T) {
+	c := client.NewClient(network, address, password)
+	callbackFunc := func(ctx context.Context, msg *client.MsgEntity) error {
+		t.Logf("receive broadcast msg, msg id: %s, msg key: %s, msg val: %s", msg.MsgID, msg.Key, msg.Val)
+		return nil
+	}
+	subscriber, err := NewBroadcastSubscriber(c, topic, callbackFunc, WithCheckpoint("instance1"))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer subscriber.Stop()
+	<-time.After(time.Minute)
+}
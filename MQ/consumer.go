@@ -3,12 +3,60 @@ package MQ
 import (
 	"context"
 	"errors"
+	"fmt"
 	"github.com/orormaybe/RedisMQ/client"
 	"github.com/orormaybe/RedisMQ/log"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 type MsgCallback func(ctx context.Context, msg *client.MsgEntity) error
 
+var ErrConsumerStopped = errors.New("consumer stopped")
+
+// PanicError 回调函数或消费流程中发生的 panic
+type PanicError struct {
+	Value any
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v\n%s", e.Value, e.Stack)
+}
+
+// 处理单条消息时通过 context 传递给中间件的信息
+type msgContext struct {
+	// 消息所属的消费者组
+	groupID string
+	// 中间件是否已经 ack 了消息
+	acked bool
+}
+
+type msgContextKey struct{}
+
+func msgContextFrom(ctx context.Context) (*msgContext, bool) {
+	mctx, ok := ctx.Value(msgContextKey{}).(*msgContext)
+	return mctx, ok
+}
+
+// 标识一条消息
+type msgRef struct {
+	topic string
+	msgID string
+}
+
+// 消息处理失败的记录
+type msgFailure struct {
+	// 处理失败的消息
+	msg *client.MsgEntity
+	// 累计失败次数
+	cnt int
+	// 最近一次失败的原因
+	lastErr error
+}
+
 type Consumer struct {
 	// redis 客户端，基于 redis 实现 message queue
 	client *client.Client
@@ -17,136 +65,581 @@ type Consumer struct {
 	stop context.CancelFunc
 	// 接收到 msg 时执行的回调函数，由使用方定义
 	callbackFunc MsgCallback
-	// 消费的 topic
-	topic string
+	// 消费的 topic，多个 topic 通过同一次 XREADGROUP 读取，按模式订阅时会动态增减
+	topicsMu sync.RWMutex
+	topics   []string
+	// 订阅的 topic 模式，非空时定期发现匹配的 stream 并自动消费
+	pattern string
+	// 各 topic 单独指定的回调函数，未指定的 topic 使用 callbackFunc
+	topicCallbacks map[string]MsgCallback
 	// 所属的消费者组
 	groupID string
 	// 当前节点的消费者 id
 	consumerID string
-	// 各消息累计失败次数
-	failureCnts map[client.MsgEntity]int
+	// 各消息累计失败次数及最近一次失败原因，并发处理时需要加锁访问
+	mu       sync.Mutex
+	failures map[msgRef]*msgFailure
 	// 一些用户自定义的配置
 	opts *ConsumerOptions
+	// 消费流程退出时关闭，分区回收时等待其关闭后再释放租约
+	done chan struct{}
+	// 导致消费流程异常退出的错误，以及最近一次接收消息失败的错误
+	errMu      sync.Mutex
+	err        error
+	receiveErr error
+	// 健康状况统计：最近一轮消费循环开始及最近一次成功接收的毫秒时间戳、连续接收失败次数、正在处理的消息数量
+	lastLoopAt        atomic.Int64
+	lastReceiveAt     atomic.Int64
+	consecutiveErrors atomic.Int64
+	inFlight          atomic.Int64
+	// 已丢弃的过期消息数量
+	expired atomic.Int64
+	// 整体暂停拉取消息
+	paused atomic.Bool
+	// 单独暂停拉取消息的 topic，由 topicsMu 保护
+	pausedTopics map[string]struct{}
+	// 恢复消费时唤醒消费流程
+	wake chan struct{}
+	// 组内成员心跳，开启 membership 配置时使用，每个 topic 各自维护
+	memberships map[string]*Membership
+	// 消费优先级 topic 时决定各优先级的读取顺序
+	scheduler *priorityScheduler
 }
 
 func NewConsumer(rc *client.Client, topic, groupID, consumerID string, callbackFunc MsgCallback, opts ...ConsumerOption) (*Consumer, error) {
+	return NewMultiTopicConsumer(rc, []string{topic}, groupID, consumerID, callbackFunc, opts...)
+}
+
+// NewMultiTopicConsumer 创建同时消费多个 topic 的 consumer，可通过 WithTopicCallback 为单个 topic 指定回调函数
+func NewMultiTopicConsumer(rc *client.Client, topics []string, groupID, consumerID string, callbackFunc MsgCallback, opts ...ConsumerOption) (*Consumer, error) {
+	return newConsumer(rc, topics, "", groupID, consumerID, callbackFunc, opts...)
+}
+
+func newConsumer(rc *client.Client, topics []string, pattern, groupID, consumerID string, callbackFunc MsgCallback, opts ...ConsumerOption) (*Consumer, error) {
 
 	ctx, stop := context.WithCancel(context.Background())
 	c := &Consumer{
 		ctx:          ctx,
 		stop:         stop,
 		client:       rc,
-		topic:        topic,
+		topics:       topics,
+		pattern:      pattern,
 		groupID:      groupID,
 		consumerID:   consumerID,
 		callbackFunc: callbackFunc,
 		opts:         &ConsumerOptions{},
-		failureCnts:  make(map[client.MsgEntity]int),
-	}
-	if err := c.checkParam(); err != nil {
-		return nil, err
+		failures:     make(map[msgRef]*msgFailure),
+		done:         make(chan struct{}),
+		pausedTopics: make(map[string]struct{}),
+		wake:         make(chan struct{}, 1),
 	}
 	for _, opt := range opts {
 		opt(c.opts)
 	}
 	repairConsumer(c.opts)
+	c.callbackFunc = chainMiddlewares(c.callbackFunc, c.opts.middlewares...)
+	c.topicCallbacks = make(map[string]MsgCallback, len(c.opts.topicCallbacks))
+	for topic, callbackFunc := range c.opts.topicCallbacks {
+		c.topicCallbacks[topic] = chainMiddlewares(callbackFunc, c.opts.middlewares...)
+	}
+	if err := c.checkParam(); err != nil {
+		return nil, err
+	}
+	if c.opts.priorityTopic != nil {
+		c.scheduler = newPriorityScheduler(*c.opts.priorityTopic, c.opts)
+	}
+	c.lastLoopAt.Store(time.Now().UnixMilli())
 	go c.run()
+	if c.opts.membership {
+		c.memberships = make(map[string]*Membership)
+		go c.keepAlive()
+	}
+	if c.pattern != "" {
+		go c.discover()
+	}
 	return c, nil
 }
 
 func (c *Consumer) checkParam() error {
-	if c.callbackFunc == nil {
-		return errors.New("callback function can't be empty")
-	}
-
 	if c.client == nil {
 		return errors.New("redis client can't be empty")
 	}
 
-	if c.topic == "" || c.consumerID == "" || c.groupID == "" {
+	if (len(c.topics) == 0 && c.pattern == "") || c.consumerID == "" || c.groupID == "" {
 		return errors.New("topic | group_id | consumer_id can't be empty")
 	}
 
+	if c.callbackFunc == nil && c.pattern != "" {
+		return errors.New("callback function can't be empty")
+	}
+
+	seen := make(map[string]struct{}, len(c.topics))
+	for _, topic := range c.topics {
+		if topic == "" {
+			return errors.New("topic | group_id | consumer_id can't be empty")
+		}
+		if _, ok := seen[topic]; ok {
+			return fmt.Errorf("duplicate topic: %s", topic)
+		}
+		seen[topic] = struct{}{}
+		if c.callbackOf(topic) == nil {
+			return errors.New("callback function can't be empty")
+		}
+	}
+
+	if c.opts.rebalanceListener != nil {
+		return errors.New("rebalance listener is only supported by partitioned consumer")
+	}
+
+	if weights := c.opts.priorityWeights; c.opts.priorityTopic != nil && len(weights) > 0 {
+		if len(weights) != c.opts.priorityTopic.Levels {
+			return fmt.Errorf("priority weights count must equal levels, weights: %d, levels: %d", len(weights), c.opts.priorityTopic.Levels)
+		}
+		for _, weight := range weights {
+			if weight <= 0 {
+				return errors.New("priority weight must be positive")
+			}
+		}
+	}
+
 	return nil
 }
 
+// 返回 topic 对应的回调函数
+func (c *Consumer) callbackOf(topic string) MsgCallback {
+	if callbackFunc, ok := c.topicCallbacks[topic]; ok {
+		return callbackFunc
+	}
+	return c.callbackFunc
+}
+
 func (c *Consumer) Stop() {
 	c.stop()
 }
 
+// Done 返回的 channel 在消费流程退出时关闭，包括主动 Stop 和异常退出
+func (c *Consumer) Done() <-chan struct{} {
+	return c.done
+}
+
+// Err 在消费流程退出前返回 nil；主动 Stop 时返回 ErrConsumerStopped，异常退出时返回导致退出的错误，
+// 包括 panic 以及通过 WithMaxReceiveErrors 设置的连续接收失败；运行中的接收错误通过 ReceiveErr 获取
+func (c *Consumer) Err() error {
+	select {
+	case <-c.done:
+	default:
+		return nil
+	}
+	c.errMu.Lock()
+	defer c.errMu.Unlock()
+	if c.err != nil {
+		return c.err
+	}
+	return ErrConsumerStopped
+}
+
+// 记录致命错误并终止消费流程
+func (c *Consumer) fail(err error) {
+	c.errMu.Lock()
+	if c.err == nil {
+		c.err = err
+	}
+	c.errMu.Unlock()
+	c.stop()
+}
+
+// Topics 返回当前正在消费的 topic
+func (c *Consumer) Topics() []string {
+	c.topicsMu.RLock()
+	defer c.topicsMu.RUnlock()
+	return append([]string(nil), c.topics...)
+}
+
+// 消费流程中回调函数之外的 panic 视为致命错误，终止消费流程，需要直接 defer 调用
+func (c *Consumer) recoverFatal() {
+	if r := recover(); r != nil {
+		err := &PanicError{Value: r, Stack: debug.Stack()}
+		log.GetDefaultLogger().Errorf("consumer exited abnormally, consumer id: %s, err: %v", c.consumerID, err)
+		c.fail(err)
+	}
+}
+
+// 记录接收消息失败，连续失败达到 maxReceiveErrors 次时终止消费流程，Err 返回最近一次的错误
+func (c *Consumer) receiveFailed(err error) {
+	// Stop 导致的失败不计入
+	if c.ctx.Err() != nil {
+		return
+	}
+	errCnt := c.consecutiveErrors.Add(1)
+	c.errMu.Lock()
+	c.receiveErr = err
+	c.errMu.Unlock()
+	if c.opts.maxReceiveErrors > 0 && errCnt >= int64(c.opts.maxReceiveErrors) {
+		log.GetDefaultLogger().Errorf("consumer exited after %d consecutive receive errors, consumer id: %s, err: %v", errCnt, c.consumerID, err)
+		c.fail(fmt.Errorf("receive msg failed %d times in a row: %w", errCnt, err))
+	}
+}
+
+// 接收消息连续失败时，等待的时长从 receiveRetryMinBackoff 开始逐次翻倍，最长为 receiveRetryMaxBackoff
+const (
+	receiveRetryMinBackoff = 100 * time.Millisecond
+	receiveRetryMaxBackoff = 5 * time.Second
+)
+
+// 接收消息失败后退避等待，避免 redis 持续报错时空转
+func (c *Consumer) receiveBackoff() {
+	backoff := receiveRetryMinBackoff
+	for i := int64(1); i < c.consecutiveErrors.Load() && backoff < receiveRetryMaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > receiveRetryMaxBackoff {
+		backoff = receiveRetryMaxBackoff
+	}
+	select {
+	case <-c.ctx.Done():
+	case <-c.wake:
+	case <-time.After(backoff):
+	}
+}
+
+// 接收消息恢复正常
+func (c *Consumer) receiveSucceeded() {
+	c.lastReceiveAt.Store(time.Now().UnixMilli())
+	c.consecutiveErrors.Store(0)
+	c.errMu.Lock()
+	c.receiveErr = nil
+	c.errMu.Unlock()
+}
+
+// ReceiveErr 返回最近一次接收消息失败的错误，接收恢复正常后返回 nil
+func (c *Consumer) ReceiveErr() error {
+	c.errMu.Lock()
+	defer c.errMu.Unlock()
+	return c.receiveErr
+}
+
 func (c *Consumer) run() {
+	defer close(c.done)
+	defer c.recoverFatal()
 	for {
 		select {
 		case <-c.ctx.Done():
 			return
 		default:
 		}
-		msgs, err := c.receive()
+		c.lastLoopAt.Store(time.Now().UnixMilli())
+		topics := c.activeTopics()
+		if c.paused.Load() || len(topics) == 0 {
+			// 已暂停，或按模式订阅时尚未发现匹配的 topic，已记录的失败次数保持不变，恢复后继续重试
+			select {
+			case <-c.ctx.Done():
+			case <-c.wake:
+			case <-time.After(c.opts.receiveTimeout):
+			}
+			continue
+		}
+		// 按 key 保序时先处理 pending list：重启或接管其他成员的消息后，pending list 中的消息早于新消息，
+		// 处理未成功的消息会记录到 failures 中，阻塞之后读取到的同 key 新消息
+		if c.opts.keyOrdered && !c.handlePending(topics) {
+			continue
+		}
+		msgs, err := c.receive(topics)
 		if err != nil {
 			log.GetDefaultLogger().Errorf("receive msg failed, err: %v", err)
+			c.receiveFailed(err)
+			c.dropNoGroupTopic(err)
+			c.receiveBackoff()
 			continue
 		}
-		tctx, _ := context.WithTimeout(c.ctx, c.opts.handleMsgsTimeout)
+		c.receiveSucceeded()
+		tctx, cancel := context.WithTimeout(c.ctx, c.opts.handleMsgsTimeout)
 		c.handlerMsgs(tctx, msgs)
+		cancel()
 
-		tctx, _ = context.WithTimeout(c.ctx, c.opts.deadLetterDeliverTimeout)
+		tctx, cancel = context.WithTimeout(c.ctx, c.opts.deadLetterDeliverTimeout)
 		c.deliverDeadLetter(tctx)
+		cancel()
 
-		pendingMsgs, err := c.receivePending()
-		if err != nil {
-			log.GetDefaultLogger().Errorf("pending msg received failed, err: %v", err)
-			continue
+		if !c.opts.keyOrdered {
+			c.handlePending(topics)
 		}
+	}
 
-		tctx, _ = context.WithTimeout(c.ctx, c.opts.handleMsgsTimeout)
-		c.handlerMsgs(tctx, pendingMsgs)
+}
+
+// 读取并处理当前消费者 pending list 中的消息，读取失败时返回 false
+func (c *Consumer) handlePending(topics []string) bool {
+	pendingMsgs, err := c.receivePending(topics)
+	if err != nil {
+		log.GetDefaultLogger().Errorf("pending msg received failed, err: %v", err)
+		c.receiveFailed(err)
+		c.dropNoGroupTopic(err)
+		c.receiveBackoff()
+		return false
 	}
+	c.pruneFailures(topics, pendingMsgs)
 
+	tctx, cancel := context.WithTimeout(c.ctx, c.opts.handleMsgsTimeout)
+	c.handlerMsgs(tctx, pendingMsgs)
+	cancel()
+	return true
 }
 
-func (c *Consumer) receive() ([]*client.MsgEntity, error) {
-	msgs, err := c.client.XReadGroup(c.ctx, c.groupID, c.consumerID, c.topic, int(c.opts.receiveTimeout.Milliseconds()))
+// 定期上报心跳，并接管组内已失效成员遗留的未 ack 消息
+// 只接管心跳过期的成员，从未上报过心跳的消费者（例如未开启 membership 或旧版本）不受影响
+func (c *Consumer) keepAlive() {
+	ticker := time.NewTicker(c.opts.rebalanceInterval)
+	defer ticker.Stop()
+	// 各 topic 下由当前节点负责接管、但仍有消息未转移完的失效成员
+	orphans := make(map[string][]string)
+	for {
+		ctx, cancel := context.WithTimeout(c.ctx, c.opts.rebalanceInterval)
+		for _, topic := range c.Topics() {
+			membership, ok := c.memberships[topic]
+			if !ok {
+				membership = NewMembership(c.client, topic, c.groupID, c.consumerID, c.opts.leaseTTL)
+				c.memberships[topic] = membership
+			}
+			_, expired, err := membership.Heartbeat(ctx)
+			if err != nil {
+				log.GetDefaultLogger().Errorf("consumer heartbeat failed, topic: %s, consumer id: %s, err: %v", topic, c.consumerID, err)
+				continue
+			}
+			for _, member := range expired {
+				log.GetDefaultLogger().Warnf("group member expired, topic: %s, group id: %s, consumer id: %s", topic, c.groupID, member)
+			}
+			orphans[topic] = append(orphans[topic], expired...)
+			if len(orphans[topic]) == 0 {
+				continue
+			}
+			remaining, err := reclaimPendingFrom(ctx, c.client, topic, c.groupID, c.consumerID, orphans[topic], c.opts.leaseTTL)
+			if err != nil {
+				log.GetDefaultLogger().Errorf("pending msgs reclaim failed, topic: %s, err: %v", topic, err)
+			}
+			orphans[topic] = remaining
+		}
+		cancel()
+
+		select {
+		case <-c.ctx.Done():
+			ctx, cancel := context.WithTimeout(context.Background(), c.opts.rebalanceInterval)
+			for topic, membership := range c.memberships {
+				if err := membership.Leave(ctx); err != nil {
+					log.GetDefaultLogger().Errorf("consumer leave failed, topic: %s, consumer id: %s, err: %v", topic, c.consumerID, err)
+				}
+			}
+			cancel()
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (c *Consumer) receive(topics []string) ([]*client.MsgEntity, error) {
+	if c.scheduler != nil {
+		return c.receiveByPriority(topics)
+	}
+	msgs, err := c.client.XReadGroupMulti(c.ctx, c.groupID, c.consumerID, topics, int(c.opts.receiveTimeout.Milliseconds()))
 	if err != nil && !errors.Is(err, client.ErrNoMsg) {
 		return nil, err
 	}
 	return msgs, nil
 }
 
-func (c *Consumer) receivePending() ([]*client.MsgEntity, error) {
-	msgs, err := c.client.XReadGroupPending(c.ctx, c.groupID, c.consumerID, c.topic)
+func (c *Consumer) receivePending(topics []string) ([]*client.MsgEntity, error) {
+	msgs, deleted, err := c.client.XReadGroupPendingMulti(c.ctx, c.groupID, c.consumerID, topics)
 	if err != nil && !errors.Is(err, client.ErrNoMsg) {
 		return nil, err
 	}
+	// 已被裁剪或删除的消息无法再处理，ack 后移出 pending list，ack 失败时下一轮重新读取到后再次 ack
+	for topic, msgIDs := range deleted {
+		for _, msgID := range msgIDs {
+			if err := c.ack(c.ctx, &client.MsgEntity{Topic: topic, MsgID: msgID}); err != nil {
+				log.GetDefaultLogger().Errorf("deleted msg ack failed, topic: %s, msg id: %s, err: %v", topic, msgID, err)
+			}
+		}
+	}
 	return msgs, nil
 }
 
 func (c *Consumer) handlerMsgs(ctx context.Context, msgs []*client.MsgEntity) {
-	for _, msg := range msgs {
-		if err := c.callbackFunc(ctx, msg); err != nil {
-			c.failureCnts[*msg]++
+	buckets := dispatchMsgs(msgs, c.opts.concurrency, c.opts.keyOrdered)
+	if len(buckets) == 1 {
+		c.handleBucket(ctx, buckets[0])
+		return
+	}
+	var wg sync.WaitGroup
+	for _, bucket := range buckets {
+		if len(bucket) == 0 {
 			continue
 		}
-		if err := c.client.XACK(ctx, c.topic, c.groupID, msg.MsgID); err != nil {
-			log.GetDefaultLogger().Errorf("msg ack failed, msg id: %s, err: %v", msg.MsgID, err)
+		wg.Add(1)
+		go func(bucket []*client.MsgEntity) {
+			defer wg.Done()
+			// 覆盖限流、ack 及失败记录等回调之外的流程，回调中的 panic 由 invoke 处理
+			defer c.recoverFatal()
+			c.handleBucket(ctx, bucket)
+		}(bucket)
+	}
+	wg.Wait()
+}
+
+// 顺序处理分配给同一个 worker 的消息
+// 按 key 保序时，某个 key 存在尚未成功的更早消息，则该 key 后续的消息本轮都不处理，
+// 它们会留在 pending list 中，等更早的消息处理成功或投递死信后再按 id 顺序重新处理
+// 限流等待超时或本轮处理超时时，剩余的消息都留在 pending list 中等待下一轮，不计入失败次数
+func (c *Consumer) handleBucket(ctx context.Context, msgs []*client.MsgEntity) {
+	// 不同 topic 下相同的 key 互不影响
+	type topicKey struct{ topic, key string }
+	blockedKeys := make(map[topicKey]struct{})
+	for i, msg := range msgs {
+		blockedKey := topicKey{topic: msg.Topic, key: msg.Key}
+		if c.opts.keyOrdered {
+			if _, ok := blockedKeys[blockedKey]; ok {
+				continue
+			}
+			if c.hasEarlierFailure(msg) {
+				blockedKeys[blockedKey] = struct{}{}
+				continue
+			}
+		}
+		handled, deferred := c.handleMsg(ctx, msg)
+		if deferred {
+			// 按 key 保序时阻塞剩余消息的 key，避免之后读取到的同 key 新消息先被处理
+			if c.opts.keyOrdered {
+				for _, rest := range msgs[i:] {
+					c.recordFailure(rest, ctx.Err(), false)
+				}
+			}
+			return
+		}
+		if !handled && c.opts.keyOrdered {
+			blockedKeys[blockedKey] = struct{}{}
+		}
+	}
+}
+
+// 处理单条消息，返回是否处理成功；deferred 为 true 表示本轮处理超时或限流等待超时，消息未被处理，本轮不再处理后续消息
+func (c *Consumer) handleMsg(ctx context.Context, msg *client.MsgEntity) (handled, deferred bool) {
+	if ctx.Err() != nil {
+		return false, true
+	}
+	if msgExpired(msg, time.Now()) {
+		return c.dropExpired(ctx, msg), false
+	}
+	for _, limiter := range c.opts.rateLimiters {
+		if err := limiter.Wait(ctx); err != nil {
+			return false, true
+		}
+	}
+	mctx := &msgContext{groupID: c.groupID}
+	if err := c.invoke(context.WithValue(ctx, msgContextKey{}, mctx), msg); err != nil {
+		c.recordFailure(msg, err, true)
+		return false, false
+	}
+	// 中间件已经完成 ack 时无需再次 ack
+	if !mctx.acked {
+		if err := c.ack(ctx, msg); err != nil {
+			log.GetDefaultLogger().Errorf("msg ack failed, topic: %s, msg id: %s, err: %v", msg.Topic, msg.MsgID, err)
+			c.recordFailure(msg, err, false)
+			return false, false
+		}
+	}
+	c.mu.Lock()
+	delete(c.failures, msgRef{topic: msg.Topic, msgID: msg.MsgID})
+	c.mu.Unlock()
+	return true, false
+}
+
+// 记录未处理成功的消息，按 key 保序时同一 key 的后续消息会等待该消息处理成功；
+// retry 为 false 时只阻塞后续消息，不计入失败次数，也不会投递死信，例如本轮未能处理或 ack 失败
+func (c *Consumer) recordFailure(msg *client.MsgEntity, err error, retry bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ref := msgRef{topic: msg.Topic, msgID: msg.MsgID}
+	failure, ok := c.failures[ref]
+	if !ok {
+		failure = &msgFailure{msg: msg}
+		c.failures[ref] = failure
+	}
+	if retry {
+		failure.cnt++
+		failure.lastErr = err
+	}
+}
+
+// 清理已经不在当前消费者 pending list 中的失败记录，例如消息已被其他消费者接管、已被 ack 或已被删除，
+// 否则按 key 保序时同一 key 的后续消息会一直被阻塞。topics 为本次读取 pending list 的 topic
+func (c *Consumer) pruneFailures(topics []string, pendingMsgs []*client.MsgEntity) {
+	read := make(map[string]struct{}, len(topics))
+	for _, topic := range topics {
+		read[topic] = struct{}{}
+	}
+	owned := make(map[msgRef]struct{}, len(pendingMsgs))
+	for _, msg := range pendingMsgs {
+		owned[msgRef{topic: msg.Topic, msgID: msg.MsgID}] = struct{}{}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for ref := range c.failures {
+		if _, ok := read[ref.topic]; !ok {
 			continue
 		}
-		delete(c.failureCnts, *msg)
+		if _, ok := owned[ref]; !ok {
+			delete(c.failures, ref)
+		}
+	}
+}
 
+// ack 消息，消息已经不在 pending list 中时视为 ack 成功，例如回调链中的中间件已经完成 ack 但外层中间件返回了错误
+func (c *Consumer) ack(ctx context.Context, msg *client.MsgEntity) error {
+	if err := c.client.XACK(ctx, msg.Topic, c.groupID, msg.MsgID); err != nil && !errors.Is(err, client.ErrMsgNotPending) {
+		return err
+	}
+	return nil
+}
+
+// 执行回调函数，回调中的 panic 仅视为当前消息处理失败，不影响消费流程
+func (c *Consumer) invoke(ctx context.Context, msg *client.MsgEntity) (err error) {
+	c.inFlight.Add(1)
+	defer c.inFlight.Add(-1)
+	defer func() {
+		if r := recover(); r != nil {
+			err = &PanicError{Value: r, Stack: debug.Stack()}
+			log.GetDefaultLogger().Errorf("msg callback panic, topic: %s, msg id: %s, err: %v", msg.Topic, msg.MsgID, err)
+		}
+	}()
+	return c.callbackOf(msg.Topic)(ctx, msg)
+}
+
+// 是否存在同一 key 下更早的、处理失败且仍在重试的消息
+func (c *Consumer) hasEarlierFailure(msg *client.MsgEntity) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for ref, failure := range c.failures {
+		if ref.topic == msg.Topic && failure.msg.Key == msg.Key && compareMsgID(ref.msgID, msg.MsgID) < 0 {
+			return true
+		}
 	}
+	return false
 }
 
 func (c *Consumer) deliverDeadLetter(ctx context.Context) {
-	for msg, failureCnt := range c.failureCnts {
-		if failureCnt < c.opts.maxRetryLimit {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for ref, failure := range c.failures {
+		// cnt 为 0 的记录只用于阻塞同一 key 的后续消息，回调并未失败，不投递死信
+		if failure.cnt == 0 || failure.cnt < c.opts.maxRetryLimit {
 			continue
 		}
-		if err := c.opts.deadLetterMailbox.Deliver(ctx, &msg); err != nil {
+		msg := failure.msg
+		if err := deliverDeadLetter(ctx, c.opts.deadLetterMailbox, msg, failure.lastErr); err != nil {
 			log.GetDefaultLogger().Errorf("dead letter deliver failed, msg id: %s, err: %v", msg.MsgID, err)
 		}
-		if err := c.client.XACK(ctx, c.topic, c.groupID, msg.MsgID); err != nil {
-			log.GetDefaultLogger().Errorf("msg ack failed, msg id: %s, err: %v", msg.MsgID, err)
+		if err := c.ack(ctx, msg); err != nil {
+			log.GetDefaultLogger().Errorf("msg ack failed, topic: %s, msg id: %s, err: %v", msg.Topic, msg.MsgID, err)
 			continue
 		}
-		delete(c.failureCnts, msg)
+		delete(c.failures, ref)
 	}
 }
@@ -2,6 +2,8 @@ package MQ
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"github.com/orormaybe/RedisMQ/client"
 	"testing"
 	"time"
@@ -40,3 +42,200 @@ func TestConsumer(t *testing.T) {
 	<-time.After(20 * time.Minute)
 
 }
+
+func TestMultiTopicConsumer(t *testing.T) {
+	c := client.NewClient(network, address, password)
+	callbackFunc := func(ctx context.Context, msg *client.MsgEntity) error {
+		t.Logf("receive msg, topic: %s, msg id: %s, msg key: %s, msg val: %s", msg.Topic, msg.MsgID, msg.Key, msg.Val)
+		return nil
+	}
+	otherCallbackFunc := func(ctx context.Context, msg *client.MsgEntity) error {
+		t.Logf("receive other msg, topic: %s, msg id: %s", msg.Topic, msg.MsgID)
+		return nil
+	}
+	consumer, err := NewMultiTopicConsumer(c, []string{topic, "test21"}, consumerGroup, consumerID, callbackFunc, WithTopicCallback("test21", otherCallbackFunc))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer consumer.Stop()
+	<-time.After(10 * time.Second)
+}
+
+func TestPatternConsumer(t *testing.T) {
+	c := client.NewClient(network, address, password)
+	callbackFunc := func(ctx context.Context, msg *client.MsgEntity) error {
+		t.Logf("receive msg, topic: %s, msg id: %s, msg key: %s, msg val: %s", msg.Topic, msg.MsgID, msg.Key, msg.Val)
+		return nil
+	}
+	consumer, err := NewPatternConsumer(c, "events.*", consumerGroup, consumerID, callbackFunc, WithDiscoveryInterval(5*time.Second))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer consumer.Stop()
+	<-time.After(20 * time.Second)
+	t.Log(consumer.Topics())
+}
+
+func TestConsumer_InvokePanic(t *testing.T) {
+	c := &Consumer{
+		callbackFunc: func(ctx context.Context, msg *client.MsgEntity) error {
+			panic("boom")
+		},
+	}
+	err := c.invoke(context.Background(), &client.MsgEntity{Topic: topic, MsgID: "1-0"})
+	var panicErr *PanicError
+	if !errors.As(err, &panicErr) {
+		t.Errorf("expect panic error, got %v", err)
+		return
+	}
+	if len(panicErr.Stack) == 0 {
+		t.Error("panic error should carry stack trace")
+	}
+}
+
+func TestConsumer_Err(t *testing.T) {
+	ctx, stop := context.WithCancel(context.Background())
+	c := &Consumer{ctx: ctx, stop: stop, done: make(chan struct{})}
+	if err := c.Err(); err != nil {
+		t.Errorf("running consumer should have no err, got %v", err)
+	}
+	c.fail(errors.New("fatal"))
+	close(c.done)
+	<-c.Done()
+	if err := c.Err(); err == nil || err.Error() != "fatal" {
+		t.Errorf("expect fatal err, got %v", err)
+	}
+}
+
+func TestConsumer_KeyOrderedRestart(t *testing.T) {
+	c := client.NewClient(network, address, password)
+	ctx := context.Background()
+	restartTopic := fmt.Sprintf("key_ordered_restart_%d", time.Now().UnixNano())
+	defer c.Del(ctx, restartTopic)
+	if err := ensureGroup(ctx, c, restartTopic, consumerGroup); err != nil {
+		t.Error(err)
+		return
+	}
+	producer := NewProducer(c)
+	if _, err := producer.SendMsg(ctx, restartTopic, "k1", "first"); err != nil {
+		t.Error(err)
+		return
+	}
+	// 模拟重启前已读取但未 ack 的消息
+	if _, err := c.XReadGroup(ctx, consumerGroup, consumerID, restartTopic, 0); err != nil {
+		t.Error(err)
+		return
+	}
+	if _, err := producer.SendMsg(ctx, restartTopic, "k1", "second"); err != nil {
+		t.Error(err)
+		return
+	}
+	received := make(chan string, 2)
+	callbackFunc := func(ctx context.Context, msg *client.MsgEntity) error {
+		received <- msg.Val
+		return nil
+	}
+	consumer, err := NewConsumer(c, restartTopic, consumerGroup, consumerID, callbackFunc, WithKeyOrdered(true), WithReceiveTimeout(100*time.Millisecond))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer consumer.Stop()
+	for _, expect := range []string{"first", "second"} {
+		select {
+		case val := <-received:
+			if val != expect {
+				t.Errorf("expect %s, got %s", expect, val)
+			}
+		case <-time.After(5 * time.Second):
+			t.Errorf("wait for %s timed out", expect)
+			return
+		}
+	}
+}
+
+func TestConsumer_PruneFailures(t *testing.T) {
+	c := &Consumer{failures: make(map[msgRef]*msgFailure)}
+	owned := &client.MsgEntity{Topic: topic, MsgID: "1-0", Key: "k1"}
+	claimed := &client.MsgEntity{Topic: topic, MsgID: "2-0", Key: "k2"}
+	c.recordFailure(owned, errors.New("fail"), true)
+	c.recordFailure(claimed, context.DeadlineExceeded, false)
+	if !c.hasEarlierFailure(&client.MsgEntity{Topic: topic, MsgID: "3-0", Key: "k2"}) {
+		t.Error("msg after an unfinished msg of the same key should be blocked")
+	}
+	c.pruneFailures([]string{topic}, []*client.MsgEntity{owned})
+	if c.hasEarlierFailure(&client.MsgEntity{Topic: topic, MsgID: "3-0", Key: "k2"}) {
+		t.Error("failure of a msg no longer pending should be pruned")
+	}
+	if failure := c.failures[msgRef{topic: topic, msgID: "1-0"}]; failure == nil || failure.cnt != 1 {
+		t.Errorf("failure of a pending msg should be kept, got %v", failure)
+	}
+}
+
+func TestConsumer_MaxReceiveErrors(t *testing.T) {
+	ctx, stop := context.WithCancel(context.Background())
+	c := &Consumer{ctx: ctx, stop: stop, done: make(chan struct{}), opts: &ConsumerOptions{maxReceiveErrors: 2}}
+	c.receiveFailed(errors.New("conn refused"))
+	if err := c.ReceiveErr(); err == nil || ctx.Err() != nil {
+		t.Errorf("first receive error should be recorded without stopping, got %v", err)
+	}
+	c.receiveFailed(errors.New("conn refused"))
+	close(c.done)
+	if err := c.Err(); err == nil || err == ErrConsumerStopped {
+		t.Errorf("expect receive err, got %v", err)
+	}
+}
+
+func TestConsumer_TimeoutNotDeadLettered(t *testing.T) {
+	var dead []*client.MsgEntity
+	opts := &ConsumerOptions{deadLetterMailbox: NewDemoDeadLetterMailbox(func(msg *client.MsgEntity) {
+		dead = append(dead, msg)
+	})}
+	repairConsumer(opts)
+	c := &Consumer{failures: make(map[msgRef]*msgFailure), opts: opts}
+	c.opts.keyOrdered = true
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	msg := &client.MsgEntity{Topic: topic, MsgID: "1-0", Key: "k1"}
+	c.handleBucket(ctx, []*client.MsgEntity{msg})
+	c.deliverDeadLetter(context.Background())
+	if len(dead) != 0 {
+		t.Errorf("timed out msg should not be dead lettered, got %d", len(dead))
+	}
+	if _, ok := c.failures[msgRef{topic: topic, msgID: "1-0"}]; !ok {
+		t.Error("timed out msg should keep blocking its key")
+	}
+}
+
+func TestConsumer_RateLimitBelowBatchSize(t *testing.T) {
+	var dead, handled []*client.MsgEntity
+	opts := &ConsumerOptions{
+		rateLimiters: []RateLimiter{NewTokenBucketLimiter(1, 1)},
+		deadLetterMailbox: NewDemoDeadLetterMailbox(func(msg *client.MsgEntity) {
+			dead = append(dead, msg)
+		}),
+	}
+	repairConsumer(opts)
+	c := &Consumer{failures: make(map[msgRef]*msgFailure), opts: opts}
+	c.callbackFunc = func(ctx context.Context, msg *client.MsgEntity) error {
+		handled = append(handled, msg)
+		// 由回调完成 ack，避免访问 redis
+		mctx, _ := msgContextFrom(ctx)
+		mctx.acked = true
+		return nil
+	}
+	msgs := []*client.MsgEntity{
+		{Topic: topic, MsgID: "1-0", Key: "k1"},
+		{Topic: topic, MsgID: "2-0", Key: "k2"},
+		{Topic: topic, MsgID: "3-0", Key: "k3"},
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	c.handleBucket(ctx, msgs)
+	c.deliverDeadLetter(context.Background())
+	if len(handled) != 1 || len(dead) != 0 || len(c.failures) != 0 {
+		t.Errorf("throttled msgs should stay pending, handled: %d, dead: %d, failures: %d", len(handled), len(dead), len(c.failures))
+	}
+}
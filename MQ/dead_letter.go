@@ -11,6 +11,20 @@ type DeadLetterMailbox interface {
 	Deliver(ctx context.Context, msg *client.MsgEntity) error
 }
 
+// 可以接收失败原因的死信队列，死信队列实现此接口时，投递时会一并带上最近一次处理失败的原因，
+// 回调函数 panic 时失败原因为 *PanicError，其中包含调用栈
+type DeadLetterCauseMailbox interface {
+	DeadLetterMailbox
+	DeliverWithCause(ctx context.Context, msg *client.MsgEntity, cause error) error
+}
+
+func deliverDeadLetter(ctx context.Context, mailbox DeadLetterMailbox, msg *client.MsgEntity, cause error) error {
+	if causeMailbox, ok := mailbox.(DeadLetterCauseMailbox); ok {
+		return causeMailbox.DeliverWithCause(ctx, msg, cause)
+	}
+	return mailbox.Deliver(ctx, msg)
+}
+
 // 默认使用的死信队列，仅仅对消息失败的信息进行日志打印
 type DeadLetterLogger struct{}
 
@@ -22,3 +36,8 @@ func (d *DeadLetterLogger) Deliver(ctx context.Context, msg *client.MsgEntity) e
 	log.GetDefaultLogger().Errorf("msg fail execeed retry limit, msg id: %s", msg.MsgID)
 	return nil
 }
+
+func (d *DeadLetterLogger) DeliverWithCause(ctx context.Context, msg *client.MsgEntity, cause error) error {
+	log.GetDefaultLogger().Errorf("msg fail execeed retry limit, msg id: %s, cause: %v", msg.MsgID, cause)
+	return nil
+}
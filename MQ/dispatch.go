@@ -0,0 +1,57 @@
+package MQ
+
+import (
+	"github.com/orormaybe/RedisMQ/client"
+	"hash/fnv"
+	"strconv"
+	"strings"
+)
+
+// 将一批消息拆分给 n 个 worker
+// keyOrdered 为 true 时，同一个 key 的消息总是落到同一个 worker，并保持原有顺序；否则按轮询方式分配
+func dispatchMsgs(msgs []*client.MsgEntity, n int, keyOrdered bool) [][]*client.MsgEntity {
+	if n <= 1 {
+		return [][]*client.MsgEntity{msgs}
+	}
+	buckets := make([][]*client.MsgEntity, n)
+	for i, msg := range msgs {
+		idx := i % n
+		if keyOrdered {
+			idx = hashKey(msg.Key, n)
+		}
+		buckets[idx] = append(buckets[idx], msg)
+	}
+	return buckets
+}
+
+// 将 key 映射到 [0, n) 区间
+func hashKey(key string, n int) int {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(key))
+	return int(h.Sum32() % uint32(n))
+}
+
+// 比较两个 stream 消息 id 的先后顺序，id 格式为 <毫秒时间戳>-<序列号>
+// a 早于 b 时返回 -1，相等返回 0，晚于 b 时返回 1
+func compareMsgID(a, b string) int {
+	aMs, aSeq := splitMsgID(a)
+	bMs, bSeq := splitMsgID(b)
+	switch {
+	case aMs < bMs:
+		return -1
+	case aMs > bMs:
+		return 1
+	case aSeq < bSeq:
+		return -1
+	case aSeq > bSeq:
+		return 1
+	}
+	return 0
+}
+
+func splitMsgID(id string) (uint64, uint64) {
+	msPart, seqPart, _ := strings.Cut(id, "-")
+	ms, _ := strconv.ParseUint(msPart, 10, 64)
+	seq, _ := strconv.ParseUint(seqPart, 10, 64)
+	return ms, seq
+}
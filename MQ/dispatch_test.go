@@ -0,0 +1,47 @@
+package MQ
+
+import (
+	"github.com/orormaybe/RedisMQ/client"
+	"testing"
+)
+
+func TestDispatchMsgs_KeyOrdered(t *testing.T) {
+	msgs := []*client.MsgEntity{
+		{MsgID: "1-0", Key: "order1"},
+		{MsgID: "2-0", Key: "order2"},
+		{MsgID: "3-0", Key: "order1"},
+		{MsgID: "4-0", Key: "order3"},
+		{MsgID: "5-0", Key: "order1"},
+	}
+	buckets := dispatchMsgs(msgs, 4, true)
+	if len(buckets) != 4 {
+		t.Fatalf("expect 4 buckets, got %d", len(buckets))
+	}
+	bucket := buckets[hashKey("order1", 4)]
+	var ids []string
+	for _, msg := range bucket {
+		if msg.Key == "order1" {
+			ids = append(ids, msg.MsgID)
+		}
+	}
+	if len(ids) != 3 || ids[0] != "1-0" || ids[1] != "3-0" || ids[2] != "5-0" {
+		t.Errorf("msgs of the same key should keep order in one bucket, got %v", ids)
+	}
+}
+
+func TestCompareMsgID(t *testing.T) {
+	cases := []struct {
+		a, b string
+		want int
+	}{
+		{"1-0", "1-0", 0},
+		{"1-0", "1-1", -1},
+		{"2-0", "1-9", 1},
+		{"9-0", "10-0", -1},
+	}
+	for _, cs := range cases {
+		if got := compareMsgID(cs.a, cs.b); got != cs.want {
+			t.Errorf("compareMsgID(%s, %s) = %d, want %d", cs.a, cs.b, got, cs.want)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package MQ
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/orormaybe/RedisMQ/client"
+	"time"
+)
+
+// 判断消息是否已处理：KEYS[1] 已处理记录，ARGV[1] 幂等键，ARGV[2] 保留时长毫秒数
+var processedCheckScript = client.NewScript(client.LuaNowMs + `
+local score = redis.call('ZSCORE', KEYS[1], ARGV[1])
+if score and tonumber(score) > now - tonumber(ARGV[2]) then
+	return 1
+end
+return 0
+`)
+
+// 记录消息已处理并 ack：KEYS[1] 已处理记录，KEYS[2] topic，ARGV[1] 幂等键，ARGV[2] 保留时长毫秒数，ARGV[3] 消费者组，ARGV[4] 消息 id
+// 同时清理超过保留时长的记录
+var processedMarkScript = client.NewScript(client.LuaNowMs + `
+local retention = tonumber(ARGV[2])
+redis.call('ZADD', KEYS[1], now, ARGV[1])
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', now - retention)
+redis.call('PEXPIRE', KEYS[1], retention)
+return redis.call('XACK', KEYS[2], ARGV[3], ARGV[4])
+`)
+
+// IdempotentMiddleware 基于 redis 实现消费侧幂等，配合至少一次的投递语义实现 exactly-once 处理
+// 每个消费者组在 redis 中记录 retention 时长内已处理成功的幂等键，重复投递的消息不再执行回调，直接 ack
+// keyFunc 用于生成幂等键，为 nil 时使用消息 id，也可以使用订单号等业务 key
+// 回调成功后，记录幂等键与 ack 在同一个 lua 脚本中原子完成；redis cluster 下需要通过 hash tag 保证记录与 topic 位于同一个 slot
+func IdempotentMiddleware(rc *client.Client, retention time.Duration, keyFunc func(msg *client.MsgEntity) string) Middleware {
+	if keyFunc == nil {
+		keyFunc = func(msg *client.MsgEntity) string {
+			return msg.MsgID
+		}
+	}
+	return func(next MsgCallback) MsgCallback {
+		return func(ctx context.Context, msg *client.MsgEntity) error {
+			mctx, ok := msgContextFrom(ctx)
+			if !ok {
+				return errors.New("idempotent middleware must be used within consumer")
+			}
+			recordKey := processedKey(msg.Topic, mctx.groupID)
+			processed, err := processedCheckScript.RunBool(ctx, rc, []string{recordKey}, keyFunc(msg), retention.Milliseconds())
+			if err != nil {
+				return err
+			}
+			// 已处理过的消息返回成功，由 consumer 正常 ack
+			if processed {
+				return nil
+			}
+			if err := next(ctx, msg); err != nil {
+				return err
+			}
+			if _, err := processedMarkScript.Run(ctx, rc, []string{recordKey, msg.Topic}, keyFunc(msg), retention.Milliseconds(), mctx.groupID, msg.MsgID); err != nil {
+				return err
+			}
+			mctx.acked = true
+			return nil
+		}
+	}
+}
+
+// 消费者组已处理消息的记录
+func processedKey(topic, groupID string) string {
+	return fmt.Sprintf("%s:processed:%s", topic, groupID)
+}
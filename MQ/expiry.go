@@ -0,0 +1,65 @@
+package MQ
+
+import (
+	"context"
+	"errors"
+	"github.com/orormaybe/RedisMQ/client"
+	"github.com/orormaybe/RedisMQ/log"
+	"strconv"
+	"time"
+)
+
+// 消息过期时间的毫秒时间戳
+const HeaderExpireAt = "x-expire-at"
+
+// ErrMsgExpired 消息已过期，过期消息投递到死信队列时作为失败原因
+var ErrMsgExpired = errors.New("msg expired")
+
+// SendMsgWithTTL 投递有效期为 ttl 的消息，消息过期后 consumer 不再执行回调函数，直接 ack
+func (p *Producer) SendMsgWithTTL(ctx context.Context, topic, key, val string, ttl time.Duration) (string, error) {
+	if ttl <= 0 {
+		return "", errors.New("msg ttl must be positive")
+	}
+	expireAt := time.Now().Add(ttl).UnixMilli()
+	return p.SendMsgWithHeaders(ctx, topic, key, val, map[string]string{HeaderExpireAt: strconv.FormatInt(expireAt, 10)})
+}
+
+// MsgExpireAt 返回消息的过期时间，没有设置有效期时 ok 为 false
+func MsgExpireAt(msg *client.MsgEntity) (expireAt time.Time, ok bool) {
+	raw, ok := msg.Headers[HeaderExpireAt]
+	if !ok {
+		return time.Time{}, false
+	}
+	ms, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.UnixMilli(ms), true
+}
+
+func msgExpired(msg *client.MsgEntity, now time.Time) bool {
+	expireAt, ok := MsgExpireAt(msg)
+	return ok && !now.Before(expireAt)
+}
+
+// 丢弃过期消息：按配置投递死信队列后 ack，返回是否处理完成，未完成的消息留在 pending list 中等待下一轮处理
+func (c *Consumer) dropExpired(ctx context.Context, msg *client.MsgEntity) bool {
+	if c.opts.deadLetterExpired {
+		if err := deliverDeadLetter(ctx, c.opts.deadLetterMailbox, msg, ErrMsgExpired); err != nil {
+			log.GetDefaultLogger().Errorf("expired msg dead letter deliver failed, topic: %s, msg id: %s, err: %v", msg.Topic, msg.MsgID, err)
+			return false
+		}
+	}
+	if err := c.ack(ctx, msg); err != nil {
+		log.GetDefaultLogger().Errorf("msg ack failed, topic: %s, msg id: %s, err: %v", msg.Topic, msg.MsgID, err)
+		return false
+	}
+	c.expired.Add(1)
+	if c.opts.expiredObserver != nil {
+		c.opts.expiredObserver(msg)
+	}
+	c.mu.Lock()
+	delete(c.failures, msgRef{topic: msg.Topic, msgID: msg.MsgID})
+	c.mu.Unlock()
+	return true
+}
@@ -0,0 +1,25 @@
+package MQ
+
+import (
+	"github.com/orormaybe/RedisMQ/client"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestMsgExpired(t *testing.T) {
+	now := time.Now()
+	msg := &client.MsgEntity{Headers: map[string]string{HeaderExpireAt: strconv.FormatInt(now.UnixMilli(), 10)}}
+	if expireAt, ok := MsgExpireAt(msg); !ok || expireAt.UnixMilli() != now.UnixMilli() {
+		t.Errorf("unexpected expire at: %v, %v", expireAt, ok)
+	}
+	if msgExpired(msg, now.Add(-time.Second)) {
+		t.Error("msg should not be expired before expire at")
+	}
+	if !msgExpired(msg, now.Add(time.Second)) {
+		t.Error("msg should be expired after expire at")
+	}
+	if msgExpired(&client.MsgEntity{}, now) {
+		t.Error("msg without ttl should never expire")
+	}
+}
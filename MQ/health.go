@@ -0,0 +1,123 @@
+package MQ
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// 连续接收失败达到此次数时，consumer 视为未就绪
+const readinessErrorThreshold = 3
+
+// ConsumerState consumer 的运行状态
+type ConsumerState int32
+
+const (
+	// StateRunning 正常拉取并处理消息
+	StateRunning ConsumerState = iota
+	// StatePaused 暂停拉取新消息，已拉取的消息继续处理
+	StatePaused
+	// StateStopped 消费流程已退出
+	StateStopped
+)
+
+func (s ConsumerState) String() string {
+	switch s {
+	case StateRunning:
+		return "running"
+	case StatePaused:
+		return "paused"
+	case StateStopped:
+		return "stopped"
+	}
+	return "unknown"
+}
+
+func (s ConsumerState) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// ConsumerHealth consumer 某一时刻的健康状况
+type ConsumerHealth struct {
+	State ConsumerState `json:"state"`
+	// 最近一次成功完成 XREADGROUP 的时间，未收到消息也视为成功
+	LastReceiveAt time.Time `json:"last_receive_at"`
+	// 连续接收失败的次数
+	ConsecutiveErrors int64 `json:"consecutive_errors"`
+	// 最近一次接收失败的原因，接收恢复正常后清空
+	ReceiveErr string `json:"receive_err,omitempty"`
+	// 正在执行回调函数的消息数量
+	InFlight int64 `json:"in_flight"`
+	// 累计丢弃的过期消息数量
+	Expired int64 `json:"expired"`
+	// 消费流程退出的原因
+	Err string `json:"err,omitempty"`
+	// 存活：消费流程未退出，且未长时间卡住
+	Live bool `json:"live"`
+	// 就绪：正常拉取消息，且与 redis 交互正常
+	Ready bool `json:"ready"`
+}
+
+// State 返回 consumer 当前的运行状态
+func (c *Consumer) State() ConsumerState {
+	select {
+	case <-c.done:
+		return StateStopped
+	default:
+	}
+	if c.paused.Load() {
+		return StatePaused
+	}
+	return StateRunning
+}
+
+// Health 返回 consumer 当前的健康状况
+func (c *Consumer) Health() ConsumerHealth {
+	health := ConsumerHealth{
+		State:             c.State(),
+		ConsecutiveErrors: c.consecutiveErrors.Load(),
+		InFlight:          c.inFlight.Load(),
+		Expired:           c.expired.Load(),
+	}
+	if err := c.ReceiveErr(); err != nil {
+		health.ReceiveErr = err.Error()
+	}
+	if lastReceiveAt := c.lastReceiveAt.Load(); lastReceiveAt > 0 {
+		health.LastReceiveAt = time.UnixMilli(lastReceiveAt)
+	}
+	if health.State == StateStopped {
+		if err := c.Err(); err != nil {
+			health.Err = err.Error()
+		}
+		return health
+	}
+	// 暂停期间消费循环仍在空转，以循环开始的时间判断是否卡住
+	health.Live = time.Since(time.UnixMilli(c.lastLoopAt.Load())) < c.opts.stallTimeout
+	health.Ready = health.State == StateRunning && health.Live && health.ConsecutiveErrors < readinessErrorThreshold
+	return health
+}
+
+// LivenessHandler 返回可用于 kubernetes 存活探针的 http handler，consumer 存活时返回 200，否则返回 503
+func (c *Consumer) LivenessHandler() http.Handler {
+	return healthHandler(c, func(health ConsumerHealth) bool {
+		return health.Live
+	})
+}
+
+// ReadinessHandler 返回可用于 kubernetes 就绪探针的 http handler，consumer 就绪时返回 200，否则返回 503
+func (c *Consumer) ReadinessHandler() http.Handler {
+	return healthHandler(c, func(health ConsumerHealth) bool {
+		return health.Ready
+	})
+}
+
+func healthHandler(c *Consumer, ok func(health ConsumerHealth) bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		health := c.Health()
+		w.Header().Set("Content-Type", "application/json")
+		if !ok(health) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		_ = json.NewEncoder(w).Encode(health)
+	})
+}
@@ -0,0 +1,55 @@
+package MQ
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func newHealthTestConsumer() *Consumer {
+	ctx, stop := context.WithCancel(context.Background())
+	opts := &ConsumerOptions{}
+	repairConsumer(opts)
+	c := &Consumer{ctx: ctx, stop: stop, opts: opts, done: make(chan struct{})}
+	c.lastLoopAt.Store(time.Now().UnixMilli())
+	return c
+}
+
+func TestConsumer_Health(t *testing.T) {
+	c := newHealthTestConsumer()
+	c.lastReceiveAt.Store(time.Now().UnixMilli())
+	health := c.Health()
+	if health.State != StateRunning || !health.Live || !health.Ready {
+		t.Errorf("consumer should be running, live and ready, got %+v", health)
+	}
+
+	c.consecutiveErrors.Store(readinessErrorThreshold)
+	if health = c.Health(); !health.Live || health.Ready {
+		t.Errorf("consumer with consecutive errors should be live but not ready, got %+v", health)
+	}
+
+	c.lastLoopAt.Store(time.Now().Add(-time.Hour).UnixMilli())
+	if health = c.Health(); health.Live {
+		t.Errorf("stalled consumer should not be live, got %+v", health)
+	}
+}
+
+func TestConsumer_HealthHandler(t *testing.T) {
+	c := newHealthTestConsumer()
+	rec := httptest.NewRecorder()
+	c.LivenessHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("expect 200, got %d", rec.Code)
+	}
+
+	c.Stop()
+	close(c.done)
+	rec = httptest.NewRecorder()
+	c.ReadinessHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("expect 503, got %d", rec.Code)
+	}
+	t.Log(rec.Body.String())
+}
@@ -0,0 +1,69 @@
+package MQ
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/demdxx/gocast"
+	"github.com/orormaybe/RedisMQ/client"
+)
+
+// 幂等投递：KEYS[1] 去重记录，KEYS[2] topic，ARGV[1] 消息 key，ARGV[2] 消息 val，ARGV[3] 去重记录有效期毫秒数，
+// ARGV[4] 裁剪参数个数 n，ARGV[5...4+n] 裁剪参数，之后为消息头的 key / val
+// 去重记录存在时直接返回其中保存的消息 id，否则投递消息并记录消息 id
+// 注意：redis cluster 下需要通过 hash tag 保证去重记录与 topic 位于同一个 slot
+var idempotentSendScript = client.NewScript(`
+local existing = redis.call('GET', KEYS[1])
+if existing then
+	return {existing, 1}
+end
+local args = {KEYS[2]}
+local trimEnd = 4 + tonumber(ARGV[4])
+for i = 5, trimEnd do
+	table.insert(args, ARGV[i])
+end
+table.insert(args, '*')
+table.insert(args, ARGV[1])
+table.insert(args, ARGV[2])
+for i = trimEnd + 1, #ARGV do
+	table.insert(args, ARGV[i])
+end
+local id = redis.call('XADD', unpack(args))
+redis.call('SET', KEYS[1], id, 'PX', ARGV[3])
+return {id, 0}
+`)
+
+// SendMsgIdempotent 以 dedupKey 为幂等键投递消息，在去重记录有效期内使用相同 dedupKey 重复投递时不会产生新消息，
+// 而是返回首次投递的消息 id，并且 duplicated 为 true
+func (p *Producer) SendMsgIdempotent(ctx context.Context, topic, dedupKey, key, val string) (msgID string, duplicated bool, err error) {
+	if topic == "" || dedupKey == "" {
+		return "", false, errors.New("topic | dedup key can't be empty")
+	}
+	sendFunc := chainInterceptors(func(ctx context.Context, topic, key, val string) (string, error) {
+		trims := p.sendTrimArgs(topic)
+		trimArgs := xaddTrimArgs(trims).Args()
+		args := append([]interface{}{key, val, p.opts.dedupTTL.Milliseconds(), len(trimArgs)}, trimArgs...)
+		for headerKey, headerVal := range HeadersFromContext(ctx) {
+			args = append(args, headerKey, headerVal)
+		}
+		reply, err := idempotentSendScript.RunValues(ctx, p.client, []string{dedupRecordKey(topic, dedupKey), topic}, args...)
+		if err != nil {
+			return "", err
+		}
+		if len(reply) != 2 {
+			return "", fmt.Errorf("invalid reply: %v", reply)
+		}
+		duplicated = gocast.ToInt64(reply[1]) == 1
+		if !duplicated {
+			p.trimAfterSend(ctx, topic, trims)
+		}
+		return gocast.ToString(reply[0]), nil
+	}, p.opts.interceptors...)
+	msgID, err = sendFunc(ctx, topic, key, val)
+	return msgID, duplicated, err
+}
+
+// 生产者幂等投递的去重记录
+func dedupRecordKey(topic, key string) string {
+	return fmt.Sprintf("%s:dedup:%s", topic, key)
+}
@@ -0,0 +1,125 @@
+package MQ
+
+import (
+	"context"
+	"errors"
+	"github.com/orormaybe/RedisMQ/client"
+	"github.com/orormaybe/RedisMQ/log"
+	"time"
+)
+
+// 删除空闲消费者：KEYS[1] topic，ARGV[1] 消费者组，ARGV[2] 消费者，ARGV[3] 最短空闲毫秒数
+// 只有消费者不再持有未 ack 的消息且空闲时长足够时才删除，检查与删除在同一个脚本中完成，避免删除期间消费者重新收到消息
+var delIdleConsumerScript = client.NewScript(`
+for _, consumer in ipairs(redis.call('XINFO', 'CONSUMERS', KEYS[1], ARGV[1])) do
+	local info = {}
+	for i = 1, #consumer, 2 do
+		info[consumer[i]] = consumer[i + 1]
+	end
+	if info['name'] == ARGV[2] then
+		if tonumber(info['pending']) > 0 or tonumber(info['idle']) < tonumber(ARGV[3]) then
+			return 0
+		end
+		redis.call('XGROUP', 'DELCONSUMER', KEYS[1], ARGV[1], ARGV[2])
+		return 1
+	end
+end
+return 0
+`)
+
+// Janitor 定期删除消费者组内长时间空闲的消费者，避免已下线实例的消费者名称在 XINFO CONSUMERS 中不断累积。
+// 已下线消费者遗留的未 ack 消息需要先由组内存活的消费者接管（参考 WithMembership），接管完成之前不会删除该消费者
+type Janitor struct {
+	client *client.Client
+	// 生命周期管理
+	ctx  context.Context
+	stop context.CancelFunc
+	// 清理的 topic 及消费者组
+	topic   string
+	groupID string
+	// 清理间隔
+	interval time.Duration
+	// 空闲超过该时长的消费者才会被删除
+	maxIdle time.Duration
+}
+
+func NewJanitor(rc *client.Client, topic, groupID string, interval, maxIdle time.Duration) (*Janitor, error) {
+	if rc == nil {
+		return nil, errors.New("redis client can't be empty")
+	}
+	if topic == "" || groupID == "" {
+		return nil, errors.New("topic | group id can't be empty")
+	}
+	if interval <= 0 || maxIdle <= 0 {
+		return nil, errors.New("clean interval | max idle must be positive")
+	}
+	ctx, stop := context.WithCancel(context.Background())
+	j := &Janitor{
+		client:   rc,
+		ctx:      ctx,
+		stop:     stop,
+		topic:    topic,
+		groupID:  groupID,
+		interval: interval,
+		maxIdle:  maxIdle,
+	}
+	go j.run()
+	return j, nil
+}
+
+func (j *Janitor) Stop() {
+	j.stop()
+}
+
+func (j *Janitor) run() {
+	ticker := time.NewTicker(j.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-j.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		ctx, cancel := context.WithTimeout(j.ctx, j.interval)
+		if _, err := j.CleanOnce(ctx); err != nil {
+			log.GetDefaultLogger().Errorf("idle consumers clean failed, topic: %s, group id: %s, err: %v", j.topic, j.groupID, err)
+		}
+		cancel()
+	}
+}
+
+// CleanOnce 立即删除组内空闲的消费者，返回被删除的消费者。
+// 通过 Membership 上报心跳的存活成员即使空闲也不会被删除
+func (j *Janitor) CleanOnce(ctx context.Context) ([]string, error) {
+	consumers, err := j.client.XInfoConsumers(ctx, j.topic, j.groupID)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	alive, err := j.client.ZRangeByScore(ctx, membersKey(j.topic, j.groupID), now.Add(-j.maxIdle).UnixMilli(), now.Add(j.maxIdle).UnixMilli())
+	if err != nil {
+		return nil, err
+	}
+	aliveSet := make(map[string]struct{}, len(alive))
+	for _, member := range alive {
+		aliveSet[member] = struct{}{}
+	}
+	var removed []string
+	for _, consumer := range consumers {
+		if _, ok := aliveSet[consumer.Name]; ok {
+			continue
+		}
+		if consumer.Pending > 0 || consumer.IdleMs < j.maxIdle.Milliseconds() {
+			continue
+		}
+		deleted, err := delIdleConsumerScript.RunBool(ctx, j.client, []string{j.topic}, j.groupID, consumer.Name, j.maxIdle.Milliseconds())
+		if err != nil {
+			return removed, err
+		}
+		if deleted {
+			log.GetDefaultLogger().Infof("idle consumer removed, topic: %s, group id: %s, consumer id: %s", j.topic, j.groupID, consumer.Name)
+			removed = append(removed, consumer.Name)
+		}
+	}
+	return removed, nil
+}
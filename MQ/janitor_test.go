@@ -0,0 +1,24 @@
+package MQ
+
+import (
+	"context"
+	"github.com/orormaybe/RedisMQ/client"
+	"testing"
+	"time"
+)
+
+func TestJanitor_CleanOnce(t *testing.T) {
+	c := client.NewClient(network, address, password)
+	janitor, err := NewJanitor(c, topic, consumerGroup, time.Minute, time.Hour)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer janitor.Stop()
+	removed, err := janitor.CleanOnce(context.Background())
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	t.Logf("removed idle consumers: %v", removed)
+}
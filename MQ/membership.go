@@ -0,0 +1,132 @@
+package MQ
+
+import (
+	"context"
+	"fmt"
+	"github.com/orormaybe/RedisMQ/client"
+	"github.com/orormaybe/RedisMQ/log"
+	"sort"
+	"time"
+)
+
+// 分区重新分配时的回调，由使用方定义
+// OnAssigned 在取得分区租约、接管分区遗留的未 ack 消息之后，开始消费之前调用
+// OnRevoked 在分区停止消费之后，释放分区租约之前调用
+type RebalanceListener interface {
+	OnAssigned(ctx context.Context, partitions []int)
+	OnRevoked(ctx context.Context, partitions []int)
+}
+
+// Membership 基于 redis 有序集合维护消费者组内的存活成员
+// 各成员定期上报心跳，分值为最近一次心跳的毫秒时间戳，超过 ttl 未上报的成员视为失效
+type Membership struct {
+	client     *client.Client
+	key        string
+	consumerID string
+	ttl        time.Duration
+}
+
+func NewMembership(rc *client.Client, topic, groupID, consumerID string, ttl time.Duration) *Membership {
+	return &Membership{
+		client:     rc,
+		key:        membersKey(topic, groupID),
+		consumerID: consumerID,
+		ttl:        ttl,
+	}
+}
+
+// Heartbeat 上报当前节点的心跳，返回按 id 排序的存活成员，以及本次由当前节点清理掉的失效成员
+// 同一个失效成员只会被一个节点清理，因此由清理者负责接管它遗留的工作
+func (m *Membership) Heartbeat(ctx context.Context) (alive []string, expired []string, err error) {
+	now := time.Now()
+	if _, err = m.client.ZAdd(ctx, m.key, now.UnixMilli(), m.consumerID); err != nil {
+		return nil, nil, err
+	}
+	deadline := now.Add(-m.ttl).UnixMilli()
+	candidates, err := m.client.ZRangeByScore(ctx, m.key, 0, deadline-1)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, candidate := range candidates {
+		removed, err := m.client.ZRem(ctx, m.key, candidate)
+		if err != nil {
+			return nil, nil, err
+		}
+		if removed == 1 {
+			expired = append(expired, candidate)
+		}
+	}
+	if alive, err = m.client.ZRangeByScore(ctx, m.key, deadline, now.Add(m.ttl).UnixMilli()); err != nil {
+		return nil, nil, err
+	}
+	sort.Strings(alive)
+	return alive, expired, nil
+}
+
+// Leave 主动退出消费者组
+func (m *Membership) Leave(ctx context.Context) error {
+	_, err := m.client.ZRem(ctx, m.key, m.consumerID)
+	return err
+}
+
+// 消费者组内存活成员的注册表
+func membersKey(topic, groupID string) string {
+	return fmt.Sprintf("%s:members:%s", topic, groupID)
+}
+
+// 将 topic 上其他消费者名下空闲超过 minIdle 的未 ack 消息转移给 consumerID，返回是否仍有消息未能转移，
+// 转移后的消息会在 consumerID 下一轮处理 pending 消息时被重新消费
+func reclaimPending(ctx context.Context, rc *client.Client, topic, groupID, consumerID string, minIdle time.Duration) (bool, error) {
+	pendings, err := rc.XPending(ctx, topic, groupID)
+	if err != nil {
+		return true, err
+	}
+	owners := make([]string, 0, len(pendings))
+	for owner := range pendings {
+		owners = append(owners, owner)
+	}
+	remaining, err := reclaimPendingFrom(ctx, rc, topic, groupID, consumerID, owners, minIdle)
+	return len(remaining) > 0 || err != nil, err
+}
+
+// 只转移 owners 名下空闲超过 minIdle 的未 ack 消息，返回仍有消息未能转移的 owner，
+// 例如失效前刚投递、空闲时长尚未达到 minIdle 的消息，需要之后再次尝试
+func reclaimPendingFrom(ctx context.Context, rc *client.Client, topic, groupID, consumerID string, owners []string, minIdle time.Duration) ([]string, error) {
+	pendings, err := rc.XPending(ctx, topic, groupID)
+	if err != nil {
+		return owners, err
+	}
+	var remaining []string
+	for i, owner := range owners {
+		cnt, ok := pendings[owner]
+		if !ok || owner == consumerID {
+			continue
+		}
+		claimed, err := claimPendingOf(ctx, rc, topic, groupID, consumerID, owner, cnt, minIdle)
+		if err != nil {
+			return append(remaining, owners[i:]...), err
+		}
+		if int64(claimed) < cnt {
+			remaining = append(remaining, owner)
+		}
+	}
+	return remaining, nil
+}
+
+// 将 owner 名下 cnt 条未 ack 消息中空闲超过 minIdle 的部分转移给 consumerID
+func claimPendingOf(ctx context.Context, rc *client.Client, topic, groupID, consumerID, owner string, cnt int64, minIdle time.Duration) (int, error) {
+	msgs, err := rc.XPendingRange(ctx, topic, groupID, owner, int(cnt))
+	if err != nil {
+		return 0, err
+	}
+	msgIDs := make([]string, 0, len(msgs))
+	for _, msg := range msgs {
+		msgIDs = append(msgIDs, msg.MsgID)
+	}
+	claimedMsgs, err := rc.XClaim(ctx, topic, groupID, consumerID, minIdle.Milliseconds(), msgIDs...)
+	if err != nil {
+		return 0, err
+	}
+	log.GetDefaultLogger().Infof("reclaim pending msgs, topic: %s, from: %s, to: %s, cnt: %d", topic, owner, consumerID, len(claimedMsgs))
+	return len(claimedMsgs), nil
+}
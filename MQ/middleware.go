@@ -0,0 +1,190 @@
+package MQ
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"github.com/orormaybe/RedisMQ/client"
+	"github.com/orormaybe/RedisMQ/log"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// Middleware 对 MsgCallback 进行包装，用于实现日志、监控、超时等横切逻辑
+type Middleware func(next MsgCallback) MsgCallback
+
+// 按顺序组装中间件，第一个中间件位于最外层
+func chainMiddlewares(callbackFunc MsgCallback, middlewares ...Middleware) MsgCallback {
+	if callbackFunc == nil {
+		return nil
+	}
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		callbackFunc = middlewares[i](callbackFunc)
+	}
+	return callbackFunc
+}
+
+// LoggingMiddleware 打印每条消息的处理结果及耗时
+func LoggingMiddleware() Middleware {
+	return func(next MsgCallback) MsgCallback {
+		return func(ctx context.Context, msg *client.MsgEntity) error {
+			start := time.Now()
+			err := next(ctx, msg)
+			if err != nil {
+				log.GetDefaultLogger().Errorf("handle msg failed, topic: %s, msg id: %s, cost: %v, err: %v", msg.Topic, msg.MsgID, time.Since(start), err)
+				return err
+			}
+			log.GetDefaultLogger().Debugf("handle msg succeeded, topic: %s, msg id: %s, cost: %v", msg.Topic, msg.MsgID, time.Since(start))
+			return nil
+		}
+	}
+}
+
+// MetricsMiddleware 在每条消息处理完成后回调 observe，由使用方对接具体的监控系统
+func MetricsMiddleware(observe func(topic string, cost time.Duration, err error)) Middleware {
+	return func(next MsgCallback) MsgCallback {
+		return func(ctx context.Context, msg *client.MsgEntity) error {
+			start := time.Now()
+			err := next(ctx, msg)
+			observe(msg.Topic, time.Since(start), err)
+			return err
+		}
+	}
+}
+
+// RecoverMiddleware 将回调函数中的 panic 转换为处理失败
+func RecoverMiddleware() Middleware {
+	return func(next MsgCallback) MsgCallback {
+		return func(ctx context.Context, msg *client.MsgEntity) (err error) {
+			defer func() {
+				if r := recover(); r != nil {
+					err = fmt.Errorf("panic: %v\n%s", r, debug.Stack())
+				}
+			}()
+			return next(ctx, msg)
+		}
+	}
+}
+
+// TimeoutMiddleware 限制单条消息的处理时长
+func TimeoutMiddleware(dur time.Duration) Middleware {
+	return func(next MsgCallback) MsgCallback {
+		return func(ctx context.Context, msg *client.MsgEntity) error {
+			tctx, cancel := context.WithTimeout(ctx, dur)
+			defer cancel()
+			return next(tctx, msg)
+		}
+	}
+}
+
+// TracingMiddleware 为每条消息开启一个 span，start 返回携带 span 的 context 以及结束 span 的函数
+func TracingMiddleware(start func(ctx context.Context, msg *client.MsgEntity) (context.Context, func(err error))) Middleware {
+	return func(next MsgCallback) MsgCallback {
+		return func(ctx context.Context, msg *client.MsgEntity) error {
+			sctx, finish := start(ctx, msg)
+			err := next(sctx, msg)
+			finish(err)
+			return err
+		}
+	}
+}
+
+// DedupMiddleware 在本地内存中记录 ttl 时长内处理成功的消息，重复投递的消息直接视为处理成功
+// 仅对当前进程生效，跨节点去重需要基于 redis 实现
+func DedupMiddleware(ttl time.Duration) Middleware {
+	type record struct {
+		id       string
+		expireAt time.Time
+	}
+	var (
+		mu        sync.Mutex
+		processed = make(map[string]time.Time)
+		// 所有记录的 ttl 相同，按写入顺序排列即按过期时间排列，清理时只需从队头开始
+		records = list.New()
+	)
+	return func(next MsgCallback) MsgCallback {
+		return func(ctx context.Context, msg *client.MsgEntity) error {
+			id := msg.Topic + ":" + msg.MsgID
+			now := time.Now()
+			mu.Lock()
+			for e := records.Front(); e != nil; e = records.Front() {
+				r := e.Value.(record)
+				if !now.After(r.expireAt) {
+					break
+				}
+				records.Remove(e)
+				// 同一条消息再次写入时会刷新过期时间，只删除与当前记录对应的过期时间
+				if processed[r.id].Equal(r.expireAt) {
+					delete(processed, r.id)
+				}
+			}
+			_, ok := processed[id]
+			mu.Unlock()
+			if ok {
+				return nil
+			}
+			if err := next(ctx, msg); err != nil {
+				return err
+			}
+			mu.Lock()
+			expireAt := time.Now().Add(ttl)
+			processed[id] = expireAt
+			records.PushBack(record{id: id, expireAt: expireAt})
+			mu.Unlock()
+			return nil
+		}
+	}
+}
+
+// SendFunc 生产者投递消息的函数
+type SendFunc func(ctx context.Context, topic, key, val string) (string, error)
+
+// ProducerInterceptor 对 SendMsg 进行包装，与消费侧的 Middleware 对应
+type ProducerInterceptor func(next SendFunc) SendFunc
+
+func chainInterceptors(sendFunc SendFunc, interceptors ...ProducerInterceptor) SendFunc {
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		sendFunc = interceptors[i](sendFunc)
+	}
+	return sendFunc
+}
+
+// LoggingInterceptor 打印每条消息的投递结果及耗时
+func LoggingInterceptor() ProducerInterceptor {
+	return func(next SendFunc) SendFunc {
+		return func(ctx context.Context, topic, key, val string) (string, error) {
+			start := time.Now()
+			msgID, err := next(ctx, topic, key, val)
+			if err != nil {
+				log.GetDefaultLogger().Errorf("send msg failed, topic: %s, msg key: %s, cost: %v, err: %v", topic, key, time.Since(start), err)
+				return msgID, err
+			}
+			log.GetDefaultLogger().Debugf("send msg succeeded, topic: %s, msg id: %s, cost: %v", topic, msgID, time.Since(start))
+			return msgID, nil
+		}
+	}
+}
+
+// MetricsInterceptor 在每条消息投递完成后回调 observe
+func MetricsInterceptor(observe func(topic string, cost time.Duration, err error)) ProducerInterceptor {
+	return func(next SendFunc) SendFunc {
+		return func(ctx context.Context, topic, key, val string) (string, error) {
+			start := time.Now()
+			msgID, err := next(ctx, topic, key, val)
+			observe(topic, time.Since(start), err)
+			return msgID, err
+		}
+	}
+}
+
+// TimeoutInterceptor 限制单次投递的时长
+func TimeoutInterceptor(dur time.Duration) ProducerInterceptor {
+	return func(next SendFunc) SendFunc {
+		return func(ctx context.Context, topic, key, val string) (string, error) {
+			tctx, cancel := context.WithTimeout(ctx, dur)
+			defer cancel()
+			return next(tctx, topic, key, val)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package MQ
+
+import (
+	"context"
+	"errors"
+	"github.com/orormaybe/RedisMQ/client"
+	"testing"
+	"time"
+)
+
+func TestChainMiddlewares(t *testing.T) {
+	var trace []string
+	record := func(name string) Middleware {
+		return func(next MsgCallback) MsgCallback {
+			return func(ctx context.Context, msg *client.MsgEntity) error {
+				trace = append(trace, name)
+				return next(ctx, msg)
+			}
+		}
+	}
+	callbackFunc := chainMiddlewares(func(ctx context.Context, msg *client.MsgEntity) error {
+		trace = append(trace, "handler")
+		return nil
+	}, record("first"), record("second"))
+	if err := callbackFunc(context.Background(), &client.MsgEntity{}); err != nil {
+		t.Error(err)
+		return
+	}
+	if len(trace) != 3 || trace[0] != "first" || trace[1] != "second" || trace[2] != "handler" {
+		t.Errorf("unexpected middleware order: %v", trace)
+	}
+}
+
+func TestRecoverMiddleware(t *testing.T) {
+	callbackFunc := chainMiddlewares(func(ctx context.Context, msg *client.MsgEntity) error {
+		panic("boom")
+	}, RecoverMiddleware())
+	if err := callbackFunc(context.Background(), &client.MsgEntity{}); err == nil {
+		t.Error("panic should be converted to error")
+	}
+}
+
+func TestDedupMiddleware(t *testing.T) {
+	var cnt int
+	callbackFunc := chainMiddlewares(func(ctx context.Context, msg *client.MsgEntity) error {
+		cnt++
+		if msg.Val == "fail" {
+			return errors.New("fail")
+		}
+		return nil
+	}, DedupMiddleware(time.Minute))
+	msg := &client.MsgEntity{Topic: topic, MsgID: "1-0"}
+	_ = callbackFunc(context.Background(), msg)
+	_ = callbackFunc(context.Background(), msg)
+	if cnt != 1 {
+		t.Errorf("duplicated msg should be skipped, handled %d times", cnt)
+	}
+	failed := &client.MsgEntity{Topic: topic, MsgID: "2-0", Val: "fail"}
+	_ = callbackFunc(context.Background(), failed)
+	_ = callbackFunc(context.Background(), failed)
+	if cnt != 3 {
+		t.Errorf("failed msg should be retried, handled %d times", cnt)
+	}
+}
+
+func TestChainInterceptors(t *testing.T) {
+	var observed string
+	sendFunc := chainInterceptors(func(ctx context.Context, topic, key, val string) (string, error) {
+		return "1-0", nil
+	}, MetricsInterceptor(func(topic string, cost time.Duration, err error) {
+		observed = topic
+	}))
+	msgID, err := sendFunc(context.Background(), topic, "key", "val")
+	if err != nil || msgID != "1-0" || observed != topic {
+		t.Errorf("unexpected send result, msg id: %s, observed: %s, err: %v", msgID, observed, err)
+	}
+}
+
+func TestIdempotentMiddleware_OutsideConsumer(t *testing.T) {
+	c := client.NewClient(network, address, password)
+	callbackFunc := chainMiddlewares(func(ctx context.Context, msg *client.MsgEntity) error {
+		return nil
+	}, IdempotentMiddleware(c, time.Hour, nil))
+	if err := callbackFunc(context.Background(), &client.MsgEntity{Topic: topic, MsgID: "1-0"}); err == nil {
+		t.Error("idempotent middleware should fail outside consumer")
+	}
+}
+
+func TestIdempotentMiddleware(t *testing.T) {
+	c := client.NewClient(network, address, password)
+	callbackFunc := func(ctx context.Context, msg *client.MsgEntity) error {
+		t.Logf("receive msg, msg id: %s, msg key: %s, msg val: %s", msg.MsgID, msg.Key, msg.Val)
+		return nil
+	}
+	// 以业务 key 去重，同一个 key 的消息只处理一次
+	keyFunc := func(msg *client.MsgEntity) string {
+		return msg.Key
+	}
+	consumer, err := NewConsumer(c, topic, consumerGroup, consumerID, callbackFunc, WithMiddleware(IdempotentMiddleware(c, time.Hour, keyFunc)))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer consumer.Stop()
+	<-time.After(10 * time.Second)
+}
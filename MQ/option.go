@@ -1,9 +1,22 @@
 package MQ
 
-import "time"
+import (
+	"github.com/orormaybe/RedisMQ/client"
+	"time"
+)
 
 type ProducerOptions struct {
 	msgQueueLen int
+	// 投递消息时依次经过的拦截器
+	interceptors []ProducerInterceptor
+	// 幂等投递时去重记录的有效期
+	dedupTTL time.Duration
+	// 默认的消息保留策略，未设置时只保留最新的 msgQueueLen 条消息
+	retention RetentionPolicy
+	// 各 topic 单独指定的消息保留策略
+	topicRetentions map[string]RetentionPolicy
+	// 是否在每次投递时裁剪，关闭后需要使用 Trimmer 在后台裁剪
+	trimOnSend bool
 }
 
 type ProducerOption func(opts *ProducerOptions)
@@ -12,6 +25,15 @@ func repairProducer(opts *ProducerOptions) {
 	if opts.msgQueueLen <= 0 {
 		opts.msgQueueLen = 500
 	}
+
+	// 安全裁剪由 Trimmer 按各自的保留策略执行，投递时不裁剪，即使未设置限制也不使用默认的条数上限
+	if opts.retention.isZero() && !opts.retention.Safe {
+		opts.retention = RetentionPolicy{MaxLen: int64(opts.msgQueueLen)}
+	}
+
+	if opts.dedupTTL <= 0 {
+		opts.dedupTTL = 24 * time.Hour
+	}
 }
 
 func WithMsgQueueLen(len int) ProducerOption {
@@ -21,6 +43,39 @@ func WithMsgQueueLen(len int) ProducerOption {
 	}
 }
 
+func WithInterceptor(interceptors ...ProducerInterceptor) ProducerOption {
+	return func(opts *ProducerOptions) {
+		opts.interceptors = append(opts.interceptors, interceptors...)
+	}
+}
+
+func WithRetention(retention RetentionPolicy) ProducerOption {
+	return func(opts *ProducerOptions) {
+		opts.retention = retention
+	}
+}
+
+func WithTopicRetention(topic string, retention RetentionPolicy) ProducerOption {
+	return func(opts *ProducerOptions) {
+		if opts.topicRetentions == nil {
+			opts.topicRetentions = make(map[string]RetentionPolicy)
+		}
+		opts.topicRetentions[topic] = retention
+	}
+}
+
+func WithTrimOnSend(enable bool) ProducerOption {
+	return func(opts *ProducerOptions) {
+		opts.trimOnSend = enable
+	}
+}
+
+func WithDedupTTL(dur time.Duration) ProducerOption {
+	return func(opts *ProducerOptions) {
+		opts.dedupTTL = dur
+	}
+}
+
 type ConsumerOptions struct {
 	// 每轮接收消息的超时时长
 	receiveTimeout time.Duration
@@ -32,6 +87,42 @@ type ConsumerOptions struct {
 	deadLetterDeliverTimeout time.Duration
 	// 处理消息流程超时阈值
 	handleMsgsTimeout time.Duration
+	// 并发处理消息的 worker 数量
+	concurrency int
+	// 是否按消息 key 保序处理，开启后同一 key 的消息总是由同一个 worker 串行处理
+	keyOrdered bool
+	// 分区租约及成员心跳的有效期，超过此时长未上报心跳的成员视为失效
+	leaseTTL time.Duration
+	// 分区重新分配及租约续期的间隔，需要小于 leaseTTL
+	rebalanceInterval time.Duration
+	// 是否向消费者组上报心跳，开启后会接管组内已失效成员遗留的未 ack 消息
+	membership bool
+	// 分区重新分配时的回调，只有分区消费者会触发
+	rebalanceListener RebalanceListener
+	// 多 topic 消费时，各 topic 单独指定的回调函数
+	topicCallbacks map[string]MsgCallback
+	// 按模式订阅时，发现新 topic 的间隔
+	discoveryInterval time.Duration
+	// 回调函数依次经过的中间件
+	middlewares []Middleware
+	// 超过此时长未完成一轮消息接收时，consumer 视为卡住，存活探针失败
+	stallTimeout time.Duration
+	// 处理每条消息前依次等待的限流器
+	rateLimiters []RateLimiter
+	// 是否将过期消息投递到死信队列，关闭时过期消息直接 ack 丢弃
+	deadLetterExpired bool
+	// 丢弃过期消息时回调，可用于上报过期消息的指标
+	expiredObserver func(msg *client.MsgEntity)
+	// 消费的优先级 topic，由 NewPriorityConsumer 设置
+	priorityTopic *PriorityTopic
+	// 各优先级的权重，设置后按权重平滑轮询读取各优先级，否则按严格优先级读取
+	priorityWeights []int
+	// 严格优先级下，低优先级超过此时长未被读取时提前读取一次，避免饥饿
+	starvationTimeout time.Duration
+	// 按优先级消费时每轮读取的消息条数，越小越能及时响应高优先级的消息
+	priorityBatchSize int
+	// 连续接收消息失败达到此次数时终止消费流程，<= 0 表示不限制
+	maxReceiveErrors int
 }
 
 type ConsumerOption func(opts *ConsumerOptions)
@@ -69,12 +160,128 @@ func WithDeadLetterMailbox(mailbox DeadLetterMailbox) ConsumerOption {
 
 }
 
+func WithConcurrency(n int) ConsumerOption {
+	return func(opts *ConsumerOptions) {
+		opts.concurrency = n
+	}
+}
+
+func WithKeyOrdered(ordered bool) ConsumerOption {
+	return func(opts *ConsumerOptions) {
+		opts.keyOrdered = ordered
+	}
+}
+
+func WithLeaseTTL(dur time.Duration) ConsumerOption {
+	return func(opts *ConsumerOptions) {
+		opts.leaseTTL = dur
+	}
+}
+
+func WithRebalanceInterval(dur time.Duration) ConsumerOption {
+	return func(opts *ConsumerOptions) {
+		opts.rebalanceInterval = dur
+	}
+}
+
+func WithMembership(enable bool) ConsumerOption {
+	return func(opts *ConsumerOptions) {
+		opts.membership = enable
+	}
+}
+
+// WithRebalanceListener 设置分区重新分配时的回调，仅用于 NewPartitionedConsumer，普通 consumer 没有分区分配，设置时创建失败
+func WithRebalanceListener(listener RebalanceListener) ConsumerOption {
+	return func(opts *ConsumerOptions) {
+		opts.rebalanceListener = listener
+	}
+}
+
+func WithTopicCallback(topic string, callbackFunc MsgCallback) ConsumerOption {
+	return func(opts *ConsumerOptions) {
+		if opts.topicCallbacks == nil {
+			opts.topicCallbacks = make(map[string]MsgCallback)
+		}
+		opts.topicCallbacks[topic] = callbackFunc
+	}
+}
+
+func WithDiscoveryInterval(dur time.Duration) ConsumerOption {
+	return func(opts *ConsumerOptions) {
+		opts.discoveryInterval = dur
+	}
+}
+
+func WithMiddleware(middlewares ...Middleware) ConsumerOption {
+	return func(opts *ConsumerOptions) {
+		opts.middlewares = append(opts.middlewares, middlewares...)
+	}
+}
+
+func WithStallTimeout(dur time.Duration) ConsumerOption {
+	return func(opts *ConsumerOptions) {
+		opts.stallTimeout = dur
+	}
+}
+
+// WithRateLimit 限制当前节点每秒处理的消息数量，burst 为允许的突发数量
+func WithRateLimit(ratePerSecond float64, burst int) ConsumerOption {
+	return func(opts *ConsumerOptions) {
+		opts.rateLimiters = append(opts.rateLimiters, NewTokenBucketLimiter(ratePerSecond, burst))
+	}
+}
+
+// WithRateLimiter 使用自定义的限流器，例如 NewGroupRateLimiter 创建的组级别分布式限流器
+func WithRateLimiter(limiter RateLimiter) ConsumerOption {
+	return func(opts *ConsumerOptions) {
+		opts.rateLimiters = append(opts.rateLimiters, limiter)
+	}
+}
+
+func WithDeadLetterExpired(enable bool) ConsumerOption {
+	return func(opts *ConsumerOptions) {
+		opts.deadLetterExpired = enable
+	}
+}
+
+func WithExpiredObserver(observe func(msg *client.MsgEntity)) ConsumerOption {
+	return func(opts *ConsumerOptions) {
+		opts.expiredObserver = observe
+	}
+}
+
+func WithPriorityWeights(weights ...int) ConsumerOption {
+	return func(opts *ConsumerOptions) {
+		opts.priorityWeights = weights
+	}
+}
+
+func WithStarvationTimeout(dur time.Duration) ConsumerOption {
+	return func(opts *ConsumerOptions) {
+		opts.starvationTimeout = dur
+	}
+}
+
+func WithPriorityBatchSize(n int) ConsumerOption {
+	return func(opts *ConsumerOptions) {
+		opts.priorityBatchSize = n
+	}
+}
+
+// WithMaxReceiveErrors 连续接收消息失败 n 次后终止消费流程，此时 Err 返回最近一次接收失败的错误，默认不限制
+func WithMaxReceiveErrors(n int) ConsumerOption {
+	return func(opts *ConsumerOptions) {
+		opts.maxReceiveErrors = n
+	}
+}
+
 func repairConsumer(opts *ConsumerOptions) {
-	if opts.receiveTimeout < 0 {
+	// BLOCK 0 会无限期阻塞，consumer 将无法及时响应 Stop，分区回收时也会一直等待其退出
+	if opts.receiveTimeout <= 0 {
 		opts.receiveTimeout = 2 * time.Second
 	}
 
-	if opts.maxRetryLimit < 0 {
+	if opts.maxRetryLimit <= 0 {
 		opts.maxRetryLimit = 3
 	}
 
@@ -89,4 +296,96 @@ func repairConsumer(opts *ConsumerOptions) {
 	if opts.handleMsgsTimeout <= 0 {
 		opts.handleMsgsTimeout = time.Second
 	}
+
+	if opts.concurrency <= 0 {
+		opts.concurrency = 1
+	}
+
+	if opts.leaseTTL < time.Second {
+		opts.leaseTTL = 10 * time.Second
+	}
+
+	if opts.rebalanceInterval <= 0 || opts.rebalanceInterval >= opts.leaseTTL {
+		opts.rebalanceInterval = opts.leaseTTL / 3
+	}
+
+	if opts.discoveryInterval <= 0 {
+		opts.discoveryInterval = 30 * time.Second
+	}
+
+	if opts.starvationTimeout <= 0 {
+		opts.starvationTimeout = 10 * time.Second
+	}
+
+	if opts.priorityBatchSize <= 0 {
+		opts.priorityBatchSize = 10
+	}
+
+	if opts.stallTimeout <= 0 {
+		// 一轮消费最长耗时的两倍，且不低于 30s
+		opts.stallTimeout = 2 * (opts.receiveTimeout + 2*opts.handleMsgsTimeout + opts.deadLetterDeliverTimeout)
+		if opts.stallTimeout < 30*time.Second {
+			opts.stallTimeout = 30 * time.Second
+		}
+	}
+}
+
+type TrimmerOptions struct {
+	// 安全裁剪时因为存在未消费的消息而无法按保留策略裁剪时回调，可用于上报积压告警指标
+	backlogObserver func(topic string, length int64)
+}
+
+type TrimmerOption func(opts *TrimmerOptions)
+
+func WithBacklogObserver(observe func(topic string, length int64)) TrimmerOption {
+	return func(opts *TrimmerOptions) {
+		opts.backlogObserver = observe
+	}
+}
+
+type BroadcastOptions struct {
+	// 每轮 XREAD 阻塞等待的时长
+	receiveTimeout time.Duration
+	// 每轮 XREAD 最多读取的消息条数
+	batchSize int
+	// 当前实例的 id，非空时将消费进度作为检查点保存在 redis 中，重启后从检查点继续
+	instanceID string
+	// 没有检查点时开始订阅的位置，为空时只接收订阅之后的新消息
+	startID string
+}
+
+type BroadcastOption func(opts *BroadcastOptions)
+
+func repairBroadcast(opts *BroadcastOptions) {
+	if opts.receiveTimeout <= 0 {
+		opts.receiveTimeout = 2 * time.Second
+	}
+
+	if opts.batchSize <= 0 {
+		opts.batchSize = 100
+	}
+}
+
+func WithBroadcastReceiveTimeout(dur time.Duration) BroadcastOption {
+	return func(opts *BroadcastOptions) {
+		opts.receiveTimeout = dur
+	}
+}
+
+func WithBroadcastBatchSize(n int) BroadcastOption {
+	return func(opts *BroadcastOptions) {
+		opts.batchSize = n
+	}
+}
+
+func WithCheckpoint(instanceID string) BroadcastOption {
+	return func(opts *BroadcastOptions) {
+		opts.instanceID = instanceID
+	}
+}
+
+func WithStartID(id string) BroadcastOption {
+	return func(opts *BroadcastOptions) {
+		opts.startID = id
+	}
 }
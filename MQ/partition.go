@@ -0,0 +1,364 @@
+package MQ
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/orormaybe/RedisMQ/client"
+	"github.com/orormaybe/RedisMQ/log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 分区 topic，消息按 key 哈希分散到 Partitions 个 stream 上，stream 名称为 <Name>:<分区序号>
+type PartitionedTopic struct {
+	Name       string
+	Partitions int
+}
+
+func NewPartitionedTopic(name string, partitions int) PartitionedTopic {
+	return PartitionedTopic{
+		Name:       name,
+		Partitions: partitions,
+	}
+}
+
+// Stream 返回分区对应的 stream 名称
+func (t PartitionedTopic) Stream(partition int) string {
+	return fmt.Sprintf("%s:%d", t.Name, partition)
+}
+
+// PartitionOf 返回 key 所属的分区
+func (t PartitionedTopic) PartitionOf(key string) int {
+	return hashKey(key, t.Partitions)
+}
+
+func (t PartitionedTopic) check() error {
+	if t.Name == "" || t.Partitions <= 0 {
+		return errors.New("partitioned topic name can't be empty and partitions must be positive")
+	}
+	return nil
+}
+
+// 分区租约，持有租约的节点才能消费对应分区
+func (t PartitionedTopic) leaseKey(partition int, groupID string) string {
+	return fmt.Sprintf("%s:lease:%s", t.Stream(partition), groupID)
+}
+
+// PartitionedConsumer 与同组的其他成员协作消费分区 topic
+// 每个分区由一个成员独占消费，独占关系通过 redis 中带过期时间的租约保证，成员加入或离开时分区会重新分配
+type PartitionedConsumer struct {
+	client *client.Client
+	// 生命周期管理
+	ctx  context.Context
+	stop context.CancelFunc
+	// 接收到 msg 时执行的回调函数，由使用方定义
+	callbackFunc MsgCallback
+	// 消费的分区 topic
+	topic PartitionedTopic
+	// 所属的消费者组
+	groupID string
+	// 当前节点的消费者 id
+	consumerID string
+	// 创建各分区 Consumer 时透传的配置
+	consumerOpts []ConsumerOption
+	opts         *ConsumerOptions
+	// 组内成员心跳
+	membership *Membership
+	// 当前节点持有租约的分区及其对应的 consumer
+	mu    sync.Mutex
+	owned map[int]*Consumer
+	// 已获取租约、但上一个持有者遗留的未 ack 消息尚未全部接管的分区，只在 run 中访问
+	unclaimed map[int]struct{}
+	// 最近一次心跳得到的存活成员，只在 run 中访问
+	members []string
+}
+
+func NewPartitionedConsumer(rc *client.Client, topic PartitionedTopic, groupID, consumerID string, callbackFunc MsgCallback, opts ...ConsumerOption) (*PartitionedConsumer, error) {
+	ctx, stop := context.WithCancel(context.Background())
+	c := &PartitionedConsumer{
+		client:       rc,
+		ctx:          ctx,
+		stop:         stop,
+		callbackFunc: callbackFunc,
+		topic:        topic,
+		groupID:      groupID,
+		consumerID:   consumerID,
+		// 组成员及分区分配由分区消费者统一维护，各分区的 consumer 无需再单独上报心跳，也不会触发分区重新分配的回调
+		consumerOpts: append(append([]ConsumerOption(nil), opts...), WithMembership(false), WithRebalanceListener(nil)),
+		opts:         &ConsumerOptions{},
+		owned:        make(map[int]*Consumer),
+		unclaimed:    make(map[int]struct{}),
+	}
+	if err := c.checkParam(); err != nil {
+		stop()
+		return nil, err
+	}
+	for _, opt := range opts {
+		opt(c.opts)
+	}
+	repairConsumer(c.opts)
+	c.membership = NewMembership(rc, topic.Name, groupID, consumerID, c.opts.leaseTTL)
+	for i := 0; i < topic.Partitions; i++ {
+		if err := ensureGroup(ctx, rc, topic.Stream(i), groupID); err != nil {
+			stop()
+			return nil, err
+		}
+	}
+	go c.run()
+	return c, nil
+}
+
+func (c *PartitionedConsumer) checkParam() error {
+	if c.callbackFunc == nil {
+		return errors.New("callback function can't be empty")
+	}
+
+	if c.client == nil {
+		return errors.New("redis client can't be empty")
+	}
+
+	if c.consumerID == "" || c.groupID == "" {
+		return errors.New("group_id | consumer_id can't be empty")
+	}
+
+	return c.topic.check()
+}
+
+func (c *PartitionedConsumer) Stop() {
+	c.stop()
+}
+
+// Partitions 返回当前节点正在消费的分区
+func (c *PartitionedConsumer) Partitions() []int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	partitions := make([]int, 0, len(c.owned))
+	for partition := range c.owned {
+		partitions = append(partitions, partition)
+	}
+	sort.Ints(partitions)
+	return partitions
+}
+
+func (c *PartitionedConsumer) run() {
+	ticker := time.NewTicker(c.opts.rebalanceInterval)
+	defer ticker.Stop()
+	for {
+		c.rebalance()
+		select {
+		case <-c.ctx.Done():
+			c.leave()
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (c *PartitionedConsumer) rebalance() {
+	ctx, cancel := context.WithTimeout(c.ctx, c.opts.rebalanceInterval)
+	defer cancel()
+	members, expired, err := c.membership.Heartbeat(ctx)
+	if err != nil {
+		log.GetDefaultLogger().Errorf("partition heartbeat failed, topic: %s, consumer id: %s, err: %v", c.topic.Name, c.consumerID, err)
+		return
+	}
+	for _, member := range expired {
+		log.GetDefaultLogger().Warnf("group member expired, topic: %s, group id: %s, consumer id: %s", c.topic.Name, c.groupID, member)
+	}
+	c.members = members
+	targets := make(map[int]struct{})
+	for _, partition := range assignPartitions(members, c.consumerID, c.topic.Partitions) {
+		targets[partition] = struct{}{}
+	}
+
+	c.mu.Lock()
+	var revoked []int
+	ttl := int64(c.opts.leaseTTL.Seconds())
+	for partition := range c.owned {
+		if _, ok := targets[partition]; !ok {
+			revoked = append(revoked, partition)
+			continue
+		}
+		// 分区的消费流程异常退出时释放租约，下一轮重新获取并重启消费
+		select {
+		case <-c.owned[partition].Done():
+			log.GetDefaultLogger().Errorf("partition consumer exited, stream: %s, err: %v", c.topic.Stream(partition), c.owned[partition].Err())
+			revoked = append(revoked, partition)
+			continue
+		default:
+		}
+		renewed, err := c.client.CompareAndExpire(ctx, c.topic.leaseKey(partition, c.groupID), c.consumerID, ttl)
+		if err != nil {
+			log.GetDefaultLogger().Errorf("partition lease renew failed, stream: %s, err: %v", c.topic.Stream(partition), err)
+			continue
+		}
+		if !renewed {
+			log.GetDefaultLogger().Warnf("partition lease lost, stream: %s, consumer id: %s", c.topic.Stream(partition), c.consumerID)
+			revoked = append(revoked, partition)
+		}
+	}
+	c.mu.Unlock()
+	c.revoke(revoked, members)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var assigned []int
+	for partition := range targets {
+		if _, ok := c.owned[partition]; ok {
+			continue
+		}
+		// 租约仍被上一个持有者占用时，等待其主动释放或过期后再接管
+		reply, err := c.client.SetNXEX(ctx, c.topic.leaseKey(partition, c.groupID), c.consumerID, ttl)
+		if err != nil || reply != 1 {
+			continue
+		}
+		// 上一个持有者释放租约或租约过期后不会再处理该分区，无论其是否存活，它遗留的未 ack 消息都由当前节点接管
+		c.unclaimed[partition] = struct{}{}
+		assigned = append(assigned, partition)
+	}
+	c.reclaimUnclaimed(ctx)
+	sort.Ints(assigned)
+	if len(assigned) > 0 && c.opts.rebalanceListener != nil {
+		c.opts.rebalanceListener.OnAssigned(ctx, assigned)
+	}
+	for _, partition := range assigned {
+		consumer, err := NewConsumer(c.client, c.topic.Stream(partition), c.groupID, c.consumerID, c.callbackFunc, c.consumerOpts...)
+		if err != nil {
+			log.GetDefaultLogger().Errorf("partition consumer start failed, stream: %s, err: %v", c.topic.Stream(partition), err)
+			_, _ = c.client.CompareAndDel(ctx, c.topic.leaseKey(partition, c.groupID), c.consumerID)
+			delete(c.unclaimed, partition)
+			continue
+		}
+		c.owned[partition] = consumer
+	}
+}
+
+// 接管各分区上一个持有者遗留的未 ack 消息
+// 只转移空闲超过租约时长的消息，避免与租约刚过期、尚未察觉的上一个持有者同时处理，其余消息在之后每一轮重试
+func (c *PartitionedConsumer) reclaimUnclaimed(ctx context.Context) {
+	for partition := range c.unclaimed {
+		more, err := reclaimPending(ctx, c.client, c.topic.Stream(partition), c.groupID, c.consumerID, c.opts.leaseTTL)
+		if err != nil {
+			log.GetDefaultLogger().Errorf("partition pending msgs reclaim failed, stream: %s, err: %v", c.topic.Stream(partition), err)
+		}
+		if !more {
+			delete(c.unclaimed, partition)
+		}
+	}
+}
+
+// 停止分区的消费，将未 ack 的消息转交给分区新的负责人后释放租约
+// 等待消费流程退出期间不持有 c.mu，避免阻塞 Partitions 等调用
+func (c *PartitionedConsumer) revoke(partitions []int, members []string) {
+	if len(partitions) == 0 {
+		return
+	}
+	sort.Ints(partitions)
+	c.mu.Lock()
+	consumers := make([]*Consumer, 0, len(partitions))
+	for _, partition := range partitions {
+		consumer := c.owned[partition]
+		consumer.Stop()
+		consumers = append(consumers, consumer)
+		delete(c.owned, partition)
+		delete(c.unclaimed, partition)
+	}
+	c.mu.Unlock()
+	// 等待消费流程退出后再转交消息、释放租约，避免与接管的节点同时处理
+	for _, consumer := range consumers {
+		<-consumer.Done()
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), c.opts.rebalanceInterval)
+	defer cancel()
+	if c.opts.rebalanceListener != nil {
+		c.opts.rebalanceListener.OnRevoked(ctx, partitions)
+	}
+	for _, partition := range partitions {
+		// 转交失败的消息仍由接管的节点在空闲超过租约时长后接管
+		if err := c.handoff(ctx, partition, members); err != nil {
+			log.GetDefaultLogger().Errorf("partition pending msgs handoff failed, stream: %s, err: %v", c.topic.Stream(partition), err)
+		}
+		if _, err := c.client.CompareAndDel(ctx, c.topic.leaseKey(partition, c.groupID), c.consumerID); err != nil {
+			log.GetDefaultLogger().Errorf("partition lease release failed, stream: %s, err: %v", c.topic.Stream(partition), err)
+		}
+	}
+}
+
+// 将当前节点在分区上未 ack 的消息转交给分区新的负责人，新负责人取得租约后直接从 pending list 继续处理，
+// 无需等待消息空闲超过租约时长；新负责人仍是当前节点或没有其他存活成员时不做转交
+func (c *PartitionedConsumer) handoff(ctx context.Context, partition int, members []string) error {
+	to := partitionOwner(members, partition)
+	if to == "" || to == c.consumerID {
+		return nil
+	}
+	stream := c.topic.Stream(partition)
+	pendings, err := c.client.XPending(ctx, stream, c.groupID)
+	if err != nil {
+		return err
+	}
+	cnt, ok := pendings[c.consumerID]
+	if !ok {
+		return nil
+	}
+	_, err = claimPendingOf(ctx, c.client, stream, c.groupID, to, c.consumerID, cnt, 0)
+	return err
+}
+
+func (c *PartitionedConsumer) leave() {
+	c.mu.Lock()
+	partitions := make([]int, 0, len(c.owned))
+	for partition := range c.owned {
+		partitions = append(partitions, partition)
+	}
+	c.mu.Unlock()
+	// 分区由其余存活成员重新分配
+	others := make([]string, 0, len(c.members))
+	for _, member := range c.members {
+		if member != c.consumerID {
+			others = append(others, member)
+		}
+	}
+	c.revoke(partitions, others)
+	ctx, cancel := context.WithTimeout(context.Background(), c.opts.rebalanceInterval)
+	defer cancel()
+	if err := c.membership.Leave(ctx); err != nil {
+		log.GetDefaultLogger().Errorf("partition member leave failed, topic: %s, consumer id: %s, err: %v", c.topic.Name, c.consumerID, err)
+	}
+}
+
+// 按成员 id 排序后轮流分配分区，所有成员基于同一份成员列表会得到一致的分配结果
+func assignPartitions(members []string, consumerID string, partitions int) []int {
+	sorted := append([]string(nil), members...)
+	sort.Strings(sorted)
+	idx := sort.SearchStrings(sorted, consumerID)
+	if idx == len(sorted) || sorted[idx] != consumerID {
+		return nil
+	}
+	var assigned []int
+	for partition := idx; partition < partitions; partition += len(sorted) {
+		assigned = append(assigned, partition)
+	}
+	return assigned
+}
+
+// 返回按 assignPartitions 的分配结果负责 partition 的成员，没有成员时返回空
+func partitionOwner(members []string, partition int) string {
+	if len(members) == 0 {
+		return ""
+	}
+	sorted := append([]string(nil), members...)
+	sort.Strings(sorted)
+	return sorted[partition%len(sorted)]
+}
+
+// 创建消费者组，stream 不存在时一并创建，组已存在时忽略
+func ensureGroup(ctx context.Context, rc *client.Client, topic, groupID string) error {
+	_, err := rc.XGroupCreateMkStream(ctx, topic, groupID)
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return err
+	}
+	return nil
+}
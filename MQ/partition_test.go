@@ -0,0 +1,191 @@
+package MQ
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/orormaybe/RedisMQ/client"
+	"testing"
+	"time"
+)
+
+func TestAssignPartitions(t *testing.T) {
+	members := []string{"cu3", "cu1", "cu2"}
+	assigned := make(map[int]string)
+	for _, member := range members {
+		for _, partition := range assignPartitions(members, member, 8) {
+			if owner, ok := assigned[partition]; ok {
+				t.Fatalf("partition %d assigned to both %s and %s", partition, owner, member)
+			}
+			assigned[partition] = member
+		}
+	}
+	if len(assigned) != 8 {
+		t.Errorf("expect all 8 partitions assigned, got %d", len(assigned))
+	}
+	if got := assignPartitions(members, "cu4", 8); len(got) != 0 {
+		t.Errorf("unknown member should not be assigned, got %v", got)
+	}
+	for partition, owner := range assigned {
+		if got := partitionOwner(members, partition); got != owner {
+			t.Errorf("partition %d expect owner %s, got %s", partition, owner, got)
+		}
+	}
+	if got := partitionOwner(nil, 0); got != "" {
+		t.Errorf("expect no owner without members, got %s", got)
+	}
+}
+
+func TestPartitionedConsumer(t *testing.T) {
+	c := client.NewClient(network, address, password)
+	pt := NewPartitionedTopic(topic, 4)
+	p := NewProducer(c)
+	for _, key := range []string{"order1", "order2", "order3"} {
+		if _, err := p.SendPartitionedMsg(context.Background(), pt, key, "val"); err != nil {
+			t.Error(err)
+			return
+		}
+	}
+	callbackFunc := func(ctx context.Context, msg *client.MsgEntity) error {
+		t.Logf("receive msg, msg id: %s, msg key: %s, msg val: %s", msg.MsgID, msg.Key, msg.Val)
+		return nil
+	}
+	consumer, err := NewPartitionedConsumer(c, pt, consumerGroup, consumerID, callbackFunc, WithLeaseTTL(3*time.Second))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer consumer.Stop()
+	<-time.After(5 * time.Second)
+	t.Log(consumer.Partitions())
+}
+
+type DemoRebalanceListener struct {
+	t *testing.T
+}
+
+func (d *DemoRebalanceListener) OnAssigned(ctx context.Context, partitions []int) {
+	d.t.Logf("partitions assigned: %v", partitions)
+}
+
+func (d *DemoRebalanceListener) OnRevoked(ctx context.Context, partitions []int) {
+	d.t.Logf("partitions revoked: %v", partitions)
+}
+
+func TestPartitionedConsumer_Rebalance(t *testing.T) {
+	c := client.NewClient(network, address, password)
+	pt := NewPartitionedTopic(topic, 4)
+	callbackFunc := func(ctx context.Context, msg *client.MsgEntity) error {
+		return nil
+	}
+	listener := &DemoRebalanceListener{t: t}
+	consumer1, err := NewPartitionedConsumer(c, pt, consumerGroup, "cu1", callbackFunc, WithLeaseTTL(3*time.Second), WithRebalanceListener(listener))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer consumer1.Stop()
+	<-time.After(3 * time.Second)
+	consumer2, err := NewPartitionedConsumer(c, pt, consumerGroup, "cu2", callbackFunc, WithLeaseTTL(3*time.Second), WithRebalanceListener(listener))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	<-time.After(6 * time.Second)
+	t.Log(consumer1.Partitions(), consumer2.Partitions())
+	consumer2.Stop()
+	<-time.After(6 * time.Second)
+	t.Log(consumer1.Partitions())
+}
+
+func TestPartitionedConsumer_ReclaimFromLiveMember(t *testing.T) {
+	c := client.NewClient(network, address, password)
+	ctx := context.Background()
+	pt := NewPartitionedTopic(fmt.Sprintf("partition_reclaim_%d", time.Now().UnixNano()), 1)
+	defer c.Del(ctx, pt.Stream(0))
+	if err := ensureGroup(ctx, c, pt.Stream(0), consumerGroup); err != nil {
+		t.Error(err)
+		return
+	}
+	if _, err := NewProducer(c).SendMsg(ctx, pt.Stream(0), "order1", "val"); err != nil {
+		t.Error(err)
+		return
+	}
+	// 上一个持有者已释放租约，但仍存活并留有未 ack 的消息
+	if _, err := c.XReadGroup(ctx, consumerGroup, "cu9", pt.Stream(0), 0); err != nil {
+		t.Error(err)
+		return
+	}
+	previous := NewMembership(c, pt.Name, consumerGroup, "cu9", 3*time.Second)
+	defer previous.Leave(ctx)
+	received := make(chan struct{}, 1)
+	callbackFunc := func(ctx context.Context, msg *client.MsgEntity) error {
+		received <- struct{}{}
+		return nil
+	}
+	consumer, err := NewPartitionedConsumer(c, pt, consumerGroup, "cu1", callbackFunc, WithLeaseTTL(time.Second), WithRebalanceInterval(200*time.Millisecond))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer consumer.Stop()
+	deadline := time.After(5 * time.Second)
+	for {
+		if _, _, err := previous.Heartbeat(ctx); err != nil {
+			t.Error(err)
+			return
+		}
+		select {
+		case <-received:
+			return
+		case <-deadline:
+			t.Error("pending msg of the previous holder not reclaimed")
+			return
+		case <-time.After(200 * time.Millisecond):
+		}
+	}
+}
+
+func TestPartitionedConsumer_RevokeHandoff(t *testing.T) {
+	c := client.NewClient(network, address, password)
+	ctx := context.Background()
+	pt := NewPartitionedTopic(fmt.Sprintf("partition_handoff_%d", time.Now().UnixNano()), 2)
+	defer c.Del(ctx, pt.Stream(0))
+	defer c.Del(ctx, pt.Stream(1))
+	// 租约时长远大于等待时间，消息只能通过撤销分区时的转交到达新的负责人
+	opts := []ConsumerOption{WithLeaseTTL(30 * time.Second), WithRebalanceInterval(200 * time.Millisecond), WithMaxRetryLimit(100)}
+	started := make(chan struct{}, 1)
+	consumer2, err := NewPartitionedConsumer(c, pt, consumerGroup, "cu2", func(ctx context.Context, msg *client.MsgEntity) error {
+		select {
+		case started <- struct{}{}:
+		default:
+		}
+		return errors.New("not handled")
+	}, opts...)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer consumer2.Stop()
+	<-time.After(time.Second)
+	if _, err := NewProducer(c).SendMsg(ctx, pt.Stream(0), "order1", "val"); err != nil {
+		t.Error(err)
+		return
+	}
+	<-started
+	received := make(chan struct{}, 1)
+	consumer1, err := NewPartitionedConsumer(c, pt, consumerGroup, "cu1", func(ctx context.Context, msg *client.MsgEntity) error {
+		received <- struct{}{}
+		return nil
+	}, opts...)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer consumer1.Stop()
+	select {
+	case <-received:
+	case <-time.After(5 * time.Second):
+		t.Errorf("pending msg not handed off, cu1: %v, cu2: %v", consumer1.Partitions(), consumer2.Partitions())
+	}
+}
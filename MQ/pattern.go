@@ -0,0 +1,118 @@
+package MQ
+
+import (
+	"context"
+	"github.com/orormaybe/RedisMQ/client"
+	"github.com/orormaybe/RedisMQ/log"
+	"strings"
+	"time"
+)
+
+// 每轮 SCAN 期望返回的 key 数量
+const scanBatchSize = 100
+
+// NewPatternConsumer 创建按 glob 模式订阅 topic 的 consumer，例如 events.*
+// consumer 会定期通过 SCAN ... TYPE stream 发现匹配的 stream，自动创建消费者组并开始消费，
+// 已不存在的 stream 则停止消费
+func NewPatternConsumer(rc *client.Client, pattern, groupID, consumerID string, callbackFunc MsgCallback, opts ...ConsumerOption) (*Consumer, error) {
+	return newConsumer(rc, nil, pattern, groupID, consumerID, callbackFunc, opts...)
+}
+
+func (c *Consumer) discover() {
+	ticker := time.NewTicker(c.opts.discoveryInterval)
+	defer ticker.Stop()
+	for {
+		ctx, cancel := context.WithTimeout(c.ctx, c.opts.discoveryInterval)
+		if err := c.refreshTopics(ctx); err != nil {
+			log.GetDefaultLogger().Errorf("topic discovery failed, pattern: %s, err: %v", c.pattern, err)
+		}
+		cancel()
+
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// 以 redis 中匹配模式的 stream 为准，更新当前消费的 topic
+func (c *Consumer) refreshTopics(ctx context.Context) error {
+	matched, err := scanStreams(ctx, c.client, c.pattern)
+	if err != nil {
+		return err
+	}
+	current := make(map[string]struct{})
+	for _, topic := range c.Topics() {
+		current[topic] = struct{}{}
+	}
+	topics := make([]string, 0, len(matched))
+	for _, topic := range matched {
+		if _, ok := current[topic]; !ok {
+			if err := ensureGroup(ctx, c.client, topic, c.groupID); err != nil {
+				log.GetDefaultLogger().Errorf("consumer group create failed, topic: %s, err: %v", topic, err)
+				continue
+			}
+			log.GetDefaultLogger().Infof("topic discovered, pattern: %s, topic: %s", c.pattern, topic)
+		}
+		topics = append(topics, topic)
+	}
+
+	c.topicsMu.Lock()
+	c.topics = topics
+	c.topicsMu.Unlock()
+	return nil
+}
+
+// 按模式订阅的 stream 被删除或重建后，消费者组随之消失，XREADGROUP 返回 NOGROUP 错误，
+// 此时将该 stream 移出当前消费的 topic，之后重新发现时会再次创建消费者组
+func (c *Consumer) dropNoGroupTopic(err error) {
+	if c.pattern == "" {
+		return
+	}
+	// 错误格式：NOGROUP No such key '<topic>' or consumer group '<group>' in XREADGROUP with GROUP option
+	_, rest, ok := strings.Cut(err.Error(), "NOGROUP No such key '")
+	if !ok {
+		return
+	}
+	topic, _, ok := strings.Cut(rest, "' or consumer group '")
+	if !ok {
+		return
+	}
+	c.topicsMu.Lock()
+	defer c.topicsMu.Unlock()
+	for i, current := range c.topics {
+		if current == topic {
+			c.topics = append(c.topics[:i:i], c.topics[i+1:]...)
+			log.GetDefaultLogger().Warnf("topic consumer group missing, stop consuming, pattern: %s, topic: %s", c.pattern, topic)
+			return
+		}
+	}
+}
+
+// 遍历所有匹配模式的 stream
+func scanStreams(ctx context.Context, rc *client.Client, pattern string) ([]string, error) {
+	var (
+		cursor int64
+		topics []string
+		seen   = make(map[string]struct{})
+	)
+	for {
+		next, keys, err := rc.Scan(ctx, cursor, pattern, "stream", scanBatchSize)
+		if err != nil {
+			return nil, err
+		}
+		// SCAN 可能重复返回同一个 key
+		for _, key := range keys {
+			if _, ok := seen[key]; ok {
+				continue
+			}
+			seen[key] = struct{}{}
+			topics = append(topics, key)
+		}
+		if next == 0 {
+			return topics, nil
+		}
+		cursor = next
+	}
+}
@@ -0,0 +1,69 @@
+package MQ
+
+import "fmt"
+
+// Pause 暂停拉取新消息，consumer 的状态及各消息的失败次数保持不变
+// 调用时已拉取的消息会继续处理完成，之后不再发起 XREADGROUP，直到 Resume
+func (c *Consumer) Pause() {
+	c.paused.Store(true)
+}
+
+// Resume 恢复拉取消息
+func (c *Consumer) Resume() {
+	c.paused.Store(false)
+	c.wakeUp()
+}
+
+// PauseTopic 多 topic 消费时暂停拉取单个 topic 的消息，其他 topic 不受影响
+func (c *Consumer) PauseTopic(topic string) error {
+	c.topicsMu.Lock()
+	defer c.topicsMu.Unlock()
+	for _, subscribed := range c.topics {
+		if subscribed == topic {
+			c.pausedTopics[topic] = struct{}{}
+			return nil
+		}
+	}
+	return fmt.Errorf("topic not subscribed: %s", topic)
+}
+
+// ResumeTopic 恢复拉取单个 topic 的消息
+func (c *Consumer) ResumeTopic(topic string) {
+	c.topicsMu.Lock()
+	delete(c.pausedTopics, topic)
+	c.topicsMu.Unlock()
+	c.wakeUp()
+}
+
+// PausedTopics 返回单独暂停的 topic
+func (c *Consumer) PausedTopics() []string {
+	c.topicsMu.RLock()
+	defer c.topicsMu.RUnlock()
+	topics := make([]string, 0, len(c.pausedTopics))
+	for _, topic := range c.topics {
+		if _, ok := c.pausedTopics[topic]; ok {
+			topics = append(topics, topic)
+		}
+	}
+	return topics
+}
+
+// 返回未被暂停的 topic
+func (c *Consumer) activeTopics() []string {
+	c.topicsMu.RLock()
+	defer c.topicsMu.RUnlock()
+	topics := make([]string, 0, len(c.topics))
+	for _, topic := range c.topics {
+		if _, ok := c.pausedTopics[topic]; !ok {
+			topics = append(topics, topic)
+		}
+	}
+	return topics
+}
+
+func (c *Consumer) wakeUp() {
+	select {
+	case c.wake <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,35 @@
+package MQ
+
+import (
+	"testing"
+)
+
+func TestConsumer_PauseTopic(t *testing.T) {
+	c := newHealthTestConsumer()
+	c.topics = []string{"test20", "test21"}
+	c.pausedTopics = make(map[string]struct{})
+	c.wake = make(chan struct{}, 1)
+	if err := c.PauseTopic("test22"); err == nil {
+		t.Error("pause unsubscribed topic should fail")
+	}
+	if err := c.PauseTopic("test21"); err != nil {
+		t.Error(err)
+		return
+	}
+	if topics := c.activeTopics(); len(topics) != 1 || topics[0] != "test20" {
+		t.Errorf("unexpected active topics: %v", topics)
+	}
+	c.ResumeTopic("test21")
+	if topics := c.activeTopics(); len(topics) != 2 {
+		t.Errorf("unexpected active topics: %v", topics)
+	}
+
+	c.Pause()
+	if state := c.State(); state != StatePaused {
+		t.Errorf("expect paused, got %s", state)
+	}
+	c.Resume()
+	if state := c.State(); state != StateRunning {
+		t.Errorf("expect running, got %s", state)
+	}
+}
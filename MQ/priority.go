@@ -0,0 +1,178 @@
+package MQ
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/orormaybe/RedisMQ/client"
+	"sort"
+	"time"
+)
+
+// 优先级 topic，每个优先级对应一个 stream，stream 名称为 <Name>:priority:<优先级>，优先级 0 最高
+type PriorityTopic struct {
+	Name   string
+	Levels int
+}
+
+func NewPriorityTopic(name string, levels int) PriorityTopic {
+	return PriorityTopic{
+		Name:   name,
+		Levels: levels,
+	}
+}
+
+// Stream 返回优先级对应的 stream 名称
+func (t PriorityTopic) Stream(priority int) string {
+	return fmt.Sprintf("%s:priority:%d", t.Name, priority)
+}
+
+// Streams 按优先级从高到低返回所有 stream 名称
+func (t PriorityTopic) Streams() []string {
+	streams := make([]string, 0, t.Levels)
+	for i := 0; i < t.Levels; i++ {
+		streams = append(streams, t.Stream(i))
+	}
+	return streams
+}
+
+func (t PriorityTopic) check() error {
+	if t.Name == "" || t.Levels <= 0 {
+		return errors.New("priority topic name can't be empty and levels must be positive")
+	}
+	return nil
+}
+
+// SendPriorityMsg 将消息投递到优先级 topic 中 priority 对应的 stream 上，priority 越小优先级越高
+func (p *Producer) SendPriorityMsg(ctx context.Context, topic PriorityTopic, priority int, key, val string) (string, error) {
+	if err := topic.check(); err != nil {
+		return "", err
+	}
+	if priority < 0 || priority >= topic.Levels {
+		return "", fmt.Errorf("priority out of range, priority: %d, levels: %d", priority, topic.Levels)
+	}
+	return p.SendMsg(ctx, topic.Stream(priority), key, val)
+}
+
+// NewPriorityConsumer 创建消费优先级 topic 的 consumer，默认按严格优先级消费，高优先级没有消息时才读取低优先级，
+// 低优先级超过 WithStarvationTimeout 未被读取时会提前读取一次，避免饥饿；
+// 通过 WithPriorityWeights 指定各优先级的权重后，按权重平滑轮询读取各优先级
+func NewPriorityConsumer(rc *client.Client, topic PriorityTopic, groupID, consumerID string, callbackFunc MsgCallback, opts ...ConsumerOption) (*Consumer, error) {
+	if rc == nil {
+		return nil, errors.New("redis client can't be empty")
+	}
+	if err := topic.check(); err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for _, stream := range topic.Streams() {
+		if err := ensureGroup(ctx, rc, stream, groupID); err != nil {
+			return nil, err
+		}
+	}
+	opts = append(append([]ConsumerOption(nil), opts...), func(opts *ConsumerOptions) {
+		opts.priorityTopic = &topic
+	})
+	return NewMultiTopicConsumer(rc, topic.Streams(), groupID, consumerID, callbackFunc, opts...)
+}
+
+// 决定每轮按什么顺序读取各优先级的 stream，只在消费流程中使用，无需加锁
+type priorityScheduler struct {
+	// stream 对应的优先级
+	levels map[string]int
+	// 各优先级的权重，为空时按严格优先级读取
+	weights []int
+	// 平滑加权轮询中各优先级的当前权重
+	current []int
+	// 各优先级最近一次被读取的时间，严格优先级下用于避免饥饿
+	lastServed        []time.Time
+	starvationTimeout time.Duration
+	// 每轮读取的消息条数
+	batchSize int
+}
+
+func newPriorityScheduler(topic PriorityTopic, opts *ConsumerOptions) *priorityScheduler {
+	s := &priorityScheduler{
+		levels:            make(map[string]int, topic.Levels),
+		weights:           opts.priorityWeights,
+		current:           make([]int, topic.Levels),
+		lastServed:        make([]time.Time, topic.Levels),
+		starvationTimeout: opts.starvationTimeout,
+		batchSize:         opts.priorityBatchSize,
+	}
+	now := time.Now()
+	for i, stream := range topic.Streams() {
+		s.levels[stream] = i
+		s.lastServed[i] = now
+	}
+	return s
+}
+
+// 按优先级从高到低排序 topic
+func (s *priorityScheduler) byLevel(topics []string) []string {
+	ordered := append([]string(nil), topics...)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return s.levels[ordered[i]] < s.levels[ordered[j]]
+	})
+	return ordered
+}
+
+// 返回本轮读取 topic 的顺序
+func (s *priorityScheduler) order(topics []string, now time.Time) []string {
+	ordered := s.byLevel(topics)
+	if len(s.weights) > 0 {
+		// 平滑加权轮询选出本轮最先读取的优先级，其余仍按优先级从高到低读取
+		pick, total := 0, 0
+		for i, topic := range ordered {
+			level := s.levels[topic]
+			s.current[level] += s.weights[level]
+			total += s.weights[level]
+			if s.current[level] > s.current[s.levels[ordered[pick]]] {
+				pick = i
+			}
+		}
+		s.current[s.levels[ordered[pick]]] -= total
+		return append([]string{ordered[pick]}, append(ordered[:pick:pick], ordered[pick+1:]...)...)
+	}
+	// 严格优先级下，超过 starvationTimeout 未被读取的优先级按等待时长从长到短提前读取
+	sort.SliceStable(ordered, func(i, j int) bool {
+		iStarving, jStarving := s.starving(ordered[i], now), s.starving(ordered[j], now)
+		if iStarving && jStarving {
+			return s.lastServed[s.levels[ordered[i]]].Before(s.lastServed[s.levels[ordered[j]]])
+		}
+		return iStarving && !jStarving
+	})
+	return ordered
+}
+
+func (s *priorityScheduler) starving(topic string, now time.Time) bool {
+	return now.Sub(s.lastServed[s.levels[topic]]) > s.starvationTimeout
+}
+
+// 记录 topic 已被读取，读取时没有消息等待同样视为已被服务
+func (s *priorityScheduler) served(topic string, now time.Time) {
+	s.lastServed[s.levels[topic]] = now
+}
+
+// 按调度顺序逐个读取各优先级，读到消息即返回；所有优先级都没有消息时，阻塞等待任意优先级的新消息
+func (c *Consumer) receiveByPriority(topics []string) ([]*client.MsgEntity, error) {
+	s := c.scheduler
+	now := time.Now()
+	ordered := s.order(topics, now)
+	for _, topic := range ordered {
+		msgs, err := c.client.XReadGroupN(c.ctx, c.groupID, c.consumerID, []string{topic}, s.batchSize, -1)
+		if err != nil && !errors.Is(err, client.ErrNoMsg) {
+			return nil, err
+		}
+		s.served(topic, now)
+		if len(msgs) > 0 {
+			return msgs, nil
+		}
+	}
+	msgs, err := c.client.XReadGroupN(c.ctx, c.groupID, c.consumerID, s.byLevel(topics), s.batchSize, int(c.opts.receiveTimeout.Milliseconds()))
+	if err != nil && !errors.Is(err, client.ErrNoMsg) {
+		return nil, err
+	}
+	return msgs, nil
+}
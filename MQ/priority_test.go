@@ -0,0 +1,34 @@
+package MQ
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPriorityScheduler_Strict(t *testing.T) {
+	topic := NewPriorityTopic("test30", 3)
+	s := newPriorityScheduler(topic, &ConsumerOptions{starvationTimeout: time.Minute})
+	now := time.Now()
+	topics := []string{topic.Stream(2), topic.Stream(0), topic.Stream(1)}
+	if ordered := s.order(topics, now); ordered[0] != topic.Stream(0) || ordered[1] != topic.Stream(1) || ordered[2] != topic.Stream(2) {
+		t.Errorf("unexpected order: %v", ordered)
+	}
+	// 只有最高优先级持续被读取，其余优先级超时后提前读取
+	s.served(topic.Stream(0), now.Add(2*time.Minute))
+	s.lastServed[1] = now.Add(time.Second)
+	if ordered := s.order(topics, now.Add(2*time.Minute)); ordered[0] != topic.Stream(2) || ordered[1] != topic.Stream(1) || ordered[2] != topic.Stream(0) {
+		t.Errorf("unexpected order: %v", ordered)
+	}
+}
+
+func TestPriorityScheduler_Weighted(t *testing.T) {
+	topic := NewPriorityTopic("test31", 3)
+	s := newPriorityScheduler(topic, &ConsumerOptions{priorityWeights: []int{5, 2, 1}})
+	cnt := make(map[string]int)
+	for i := 0; i < 80; i++ {
+		cnt[s.order(topic.Streams(), time.Now())[0]]++
+	}
+	if cnt[topic.Stream(0)] != 50 || cnt[topic.Stream(1)] != 20 || cnt[topic.Stream(2)] != 10 {
+		t.Errorf("unexpected picks: %v", cnt)
+	}
+}
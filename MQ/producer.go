@@ -8,21 +8,72 @@ import (
 type Producer struct {
 	client *client.Client
 	opts   *ProducerOptions
+	// 经过拦截器包装后的投递函数
+	sendFunc SendFunc
 }
 
 func NewProducer(client *client.Client, opts ...ProducerOption) *Producer {
 	p := &Producer{
 		client: client,
-		opts:   &ProducerOptions{},
+		opts: &ProducerOptions{
+			trimOnSend: true,
+		},
 	}
 	for _, opt := range opts {
 		opt(p.opts)
 	}
 	repairProducer(p.opts)
+	p.sendFunc = chainInterceptors(p.send, p.opts.interceptors...)
 	return p
 
 }
 
 func (p *Producer) SendMsg(ctx context.Context, topic, key, val string) (string, error) {
-	return p.client.XADD(ctx, topic, p.opts.msgQueueLen, key, val)
+	return p.sendFunc(ctx, topic, key, val)
+}
+
+// SendMsgWithHeaders 投递带消息头的消息，拦截器可以通过 HeadersFromContext 读取和修改消息头
+func (p *Producer) SendMsgWithHeaders(ctx context.Context, topic, key, val string, headers map[string]string) (string, error) {
+	return p.sendFunc(ContextWithHeaders(ctx, headers), topic, key, val)
+}
+
+func (p *Producer) send(ctx context.Context, topic, key, val string) (string, error) {
+	trims := p.sendTrimArgs(topic)
+	msgID, err := p.client.XADDWithHeaders(ctx, topic, xaddTrimArgs(trims), key, val, HeadersFromContext(ctx))
+	if err != nil {
+		return "", err
+	}
+	p.trimAfterSend(ctx, topic, trims)
+	return msgID, nil
+}
+
+type headersKey struct{}
+
+// ContextWithHeaders 返回携带消息头的 context，通过该 context 投递的消息会带上这些消息头
+func ContextWithHeaders(ctx context.Context, headers map[string]string) context.Context {
+	if len(headers) == 0 {
+		return ctx
+	}
+	merged := make(map[string]string, len(headers))
+	for k, v := range HeadersFromContext(ctx) {
+		merged[k] = v
+	}
+	for k, v := range headers {
+		merged[k] = v
+	}
+	return context.WithValue(ctx, headersKey{}, merged)
+}
+
+// HeadersFromContext 返回 context 中携带的消息头，不存在时返回 nil
+func HeadersFromContext(ctx context.Context) map[string]string {
+	headers, _ := ctx.Value(headersKey{}).(map[string]string)
+	return headers
+}
+
+// SendPartitionedMsg 按 key 将消息投递到分区 topic 对应的 stream 上，同一个 key 的消息总是落在同一分区
+func (p *Producer) SendPartitionedMsg(ctx context.Context, topic PartitionedTopic, key, val string) (string, error) {
+	if err := topic.check(); err != nil {
+		return "", err
+	}
+	return p.SendMsg(ctx, topic.Stream(topic.PartitionOf(key)), key, val)
 }
@@ -4,6 +4,7 @@ import (
 	"context"
 	"github.com/orormaybe/RedisMQ/client"
 	"testing"
+	"time"
 )
 
 const (
@@ -25,3 +26,21 @@ func TestProducer_SendMsg(t *testing.T) {
 	}
 	t.Log(reply)
 }
+
+func TestProducer_SendMsgIdempotent(t *testing.T) {
+	client := client.NewClient(network, address, password)
+	p := NewProducer(client, WithDedupTTL(time.Minute))
+	msgID, duplicated, err := p.SendMsgIdempotent(context.Background(), topic, "order-1001", "test30", "val21")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	retryMsgID, duplicated, err := p.SendMsgIdempotent(context.Background(), topic, "order-1001", "test30", "val21")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if !duplicated || retryMsgID != msgID {
+		t.Errorf("retry should return original msg id %s, got %s, duplicated: %v", msgID, retryMsgID, duplicated)
+	}
+}
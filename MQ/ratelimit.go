@@ -0,0 +1,74 @@
+package MQ
+
+import (
+	"context"
+	"fmt"
+	"github.com/orormaybe/RedisMQ/client"
+	"github.com/orormaybe/RedisMQ/ratelimit"
+	"math"
+	"sync"
+	"time"
+)
+
+// RateLimiter 消息处理限流器，Wait 阻塞直到允许处理下一条消息，或 ctx 结束
+type RateLimiter interface {
+	Wait(ctx context.Context) error
+}
+
+// 本地令牌桶，以 rate 条每秒的速度生成令牌，最多累积 burst 个
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// NewTokenBucketLimiter 创建本地令牌桶限流器，仅限制当前节点
+func NewTokenBucketLimiter(ratePerSecond float64, burst int) RateLimiter {
+	if burst <= 0 {
+		burst = 1
+	}
+	return &tokenBucket{
+		rate:   ratePerSecond,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+func (b *tokenBucket) Wait(ctx context.Context) error {
+	// 速率非正数时不限流
+	if b.rate <= 0 {
+		return nil
+	}
+	for {
+		b.mu.Lock()
+		now := time.Now()
+		b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+		b.last = now
+		if b.tokens >= 1 {
+			b.tokens--
+			b.mu.Unlock()
+			return nil
+		}
+		wait := time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+		b.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+// NewGroupRateLimiter 创建消费者组级别的分布式限流器，组内所有成员在每个 window 内合计最多处理 limit 条消息
+// 需要其他限流算法时，可以通过 ratelimit.Bind 将 ratelimit 包中的限流器绑定到自定义的 key 上
+func NewGroupRateLimiter(rc *client.Client, topic, groupID string, limit int, window time.Duration) (RateLimiter, error) {
+	limiter, err := ratelimit.NewFixedWindow(rc, limit, window)
+	if err != nil {
+		return nil, err
+	}
+	return ratelimit.Bind(limiter, fmt.Sprintf("%s:ratelimit:%s", topic, groupID)), nil
+}
@@ -0,0 +1,49 @@
+package MQ
+
+import (
+	"context"
+	"github.com/orormaybe/RedisMQ/client"
+	"testing"
+	"time"
+)
+
+func TestTokenBucketLimiter(t *testing.T) {
+	limiter := NewTokenBucketLimiter(20, 5)
+	start := time.Now()
+	for i := 0; i < 10; i++ {
+		if err := limiter.Wait(context.Background()); err != nil {
+			t.Error(err)
+			return
+		}
+	}
+	// 前 5 条消耗突发配额，后 5 条按 20/s 的速度放行
+	if cost := time.Since(start); cost < 200*time.Millisecond || cost > time.Second {
+		t.Errorf("unexpected cost: %v", cost)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := NewTokenBucketLimiter(0.1, 1).Wait(ctx); err != nil {
+		t.Error(err)
+	}
+	if err := limiter.Wait(ctx); err == nil {
+		t.Error("wait should fail when ctx is done")
+	}
+}
+
+func TestGroupRateLimiter(t *testing.T) {
+	c := client.NewClient(network, address, password)
+	limiter, err := NewGroupRateLimiter(c, topic, consumerGroup, 5, time.Second)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	start := time.Now()
+	for i := 0; i < 10; i++ {
+		if err := limiter.Wait(context.Background()); err != nil {
+			t.Error(err)
+			return
+		}
+	}
+	t.Log(time.Since(start))
+}
@@ -0,0 +1,87 @@
+package MQ
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/orormaybe/RedisMQ/client"
+	"strconv"
+	"time"
+)
+
+// Reader 不经过消费者组，按 id 顺序回放 topic 中指定区间的消息，用于重建投影、排查问题等场景。
+// 回放不会 ack 消息，也不会影响任何消费者组的消费进度
+type Reader struct {
+	client *client.Client
+	topic  string
+	// 每次 XRANGE 读取的消息条数
+	batchSize int
+}
+
+func NewReader(rc *client.Client, topic string, batchSize int) (*Reader, error) {
+	if rc == nil {
+		return nil, errors.New("redis client can't be empty")
+	}
+	if topic == "" {
+		return nil, errors.New("topic can't be empty")
+	}
+	if batchSize <= 0 {
+		batchSize = 100
+	}
+	return &Reader{
+		client:    rc,
+		topic:     topic,
+		batchSize: batchSize,
+	}, nil
+}
+
+// Replay 依次将 id 位于 [start, end] 区间内的消息交给 callback 处理，callback 返回错误时停止回放并返回该错误。
+// start 为空时从最早的消息开始，end 为空时回放到开始回放时的最新一条消息，回放期间新投递的消息不会被读取
+func (r *Reader) Replay(ctx context.Context, start, end string, callback MsgCallback) error {
+	if callback == nil {
+		return errors.New("callback can't be empty")
+	}
+	if start == "" {
+		start = "-"
+	}
+	if end == "" {
+		last, err := r.client.XRevRange(ctx, r.topic, "+", "-", 1)
+		if err != nil {
+			return err
+		}
+		if len(last) == 0 {
+			return nil
+		}
+		end = last[0].MsgID
+	}
+	for {
+		msgs, err := r.client.XRange(ctx, r.topic, start, end, r.batchSize)
+		if err != nil {
+			return err
+		}
+		for _, msg := range msgs {
+			if err := callback(ctx, msg); err != nil {
+				return fmt.Errorf("replay msg failed, topic: %s, msg id: %s: %w", r.topic, msg.MsgID, err)
+			}
+		}
+		if len(msgs) < r.batchSize {
+			return nil
+		}
+		// 下一批从上一批最后一条消息之后开始
+		start = "(" + msgs[len(msgs)-1].MsgID
+	}
+}
+
+// ReplayTime 回放 [from, to] 时间范围内投递的消息，时间精度为毫秒。
+// from 为零值时从最早的消息开始，to 为零值时回放到开始回放时的最新一条消息
+func (r *Reader) ReplayTime(ctx context.Context, from, to time.Time, callback MsgCallback) error {
+	var start, end string
+	if !from.IsZero() {
+		start = msgIDFromTime(from)
+	}
+	if !to.IsZero() {
+		// 只指定毫秒时间戳的 id 作为结束位置时，包含该毫秒内的所有消息
+		end = strconv.FormatInt(to.UnixMilli(), 10)
+	}
+	return r.Replay(ctx, start, end, callback)
+}
@@ -0,0 +1,24 @@
+package MQ
+
+import (
+	"context"
+	"github.com/orormaybe/RedisMQ/client"
+	"testing"
+	"time"
+)
+
+func TestReader_ReplayTime(t *testing.T) {
+	c := client.NewClient(network, address, password)
+	reader, err := NewReader(c, topic, 10)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	err = reader.ReplayTime(context.Background(), time.Now().Add(-time.Hour), time.Time{}, func(ctx context.Context, msg *client.MsgEntity) error {
+		t.Logf("replay msg, msg id: %s, msg key: %s, msg val: %s", msg.MsgID, msg.Key, msg.Val)
+		return nil
+	})
+	if err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,269 @@
+package MQ
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/orormaybe/RedisMQ/client"
+	"github.com/orormaybe/RedisMQ/log"
+	"time"
+)
+
+// RetentionPolicy topic 的消息保留策略
+type RetentionPolicy struct {
+	// 最多保留的消息条数，0 表示不按条数限制
+	MaxLen int64
+	// 最长保留时长，通过 MINID 删除更早的消息，0 表示不按时间限制
+	MaxAge time.Duration
+	// 是否使用近似裁剪，开销更低，但实际保留的消息可能略多于限制
+	Approx bool
+	// 安全裁剪，只删除所有消费者组都已经读取并 ack 的消息，投递时不再裁剪，需要配合 Trimmer 使用
+	Safe bool
+}
+
+func (r RetentionPolicy) isZero() bool {
+	return r.MaxLen <= 0 && r.MaxAge <= 0
+}
+
+// 将保留策略转换为裁剪参数，同时设置了条数和时长时返回两组参数
+func (r RetentionPolicy) trimArgs(now time.Time) []*client.TrimArgs {
+	var trims []*client.TrimArgs
+	if r.MaxAge > 0 {
+		trims = append(trims, &client.TrimArgs{MinID: msgIDFromTime(now.Add(-r.MaxAge)), Approx: r.Approx})
+	}
+	if r.MaxLen > 0 {
+		trims = append(trims, &client.TrimArgs{MaxLen: r.MaxLen, Approx: r.Approx})
+	}
+	return trims
+}
+
+// 返回毫秒时间戳为 t 的最小消息 id
+func msgIDFromTime(t time.Time) string {
+	return fmt.Sprintf("%d-0", t.UnixMilli())
+}
+
+// 返回 topic 生效的保留策略
+func (opts *ProducerOptions) retentionOf(topic string) RetentionPolicy {
+	if retention, ok := opts.topicRetentions[topic]; ok {
+		return retention
+	}
+	return opts.retention
+}
+
+// 投递消息时使用的裁剪参数，XADD 只支持一种裁剪条件，同时设置了条数和时长时 XADD 按时长裁剪，
+// 条数由 trimAfterSend 在投递成功后补充裁剪
+func (p *Producer) sendTrimArgs(topic string) []*client.TrimArgs {
+	retention := p.opts.retentionOf(topic)
+	if !p.opts.trimOnSend || retention.Safe {
+		return nil
+	}
+	return retention.trimArgs(time.Now())
+}
+
+// XADD 携带的裁剪参数
+func xaddTrimArgs(trims []*client.TrimArgs) *client.TrimArgs {
+	if len(trims) == 0 {
+		return nil
+	}
+	return trims[0]
+}
+
+// 补充执行 XADD 未能携带的裁剪条件，裁剪失败只记录日志，不影响投递结果
+func (p *Producer) trimAfterSend(ctx context.Context, topic string, trims []*client.TrimArgs) {
+	for i := 1; i < len(trims); i++ {
+		if _, err := p.client.XTRIM(ctx, topic, trims[i]); err != nil {
+			log.GetDefaultLogger().Errorf("topic trim after send failed, topic: %s, err: %v", topic, err)
+		}
+	}
+}
+
+// 安全裁剪：KEYS[1] topic，ARGV[1] 最多保留的消息条数，ARGV[2] 按时长保留时的最小消息 id，ARGV[3] 是否近似裁剪，ARGV[4] 单次最多裁剪的条数
+// 先按保留策略计算裁剪位置，再与所有消费者组最早的未 ack 消息及 last-delivered-id 比较取较小者，保证不删除未消费的消息
+// 无论按条数还是按时长裁剪，每次最多裁剪 ARGV[4] 条，避免脚本长时间阻塞 redis
+// 返回 {删除的消息数，是否因为存在未消费的消息而少裁剪，裁剪后的 stream 长度，是否还有超出保留策略的消息待裁剪}
+var safeTrimScript = client.NewScript(`
+local function less(a, b)
+	local ams, aseq = string.match(a, '(%d+)-(%d+)')
+	local bms, bseq = string.match(b, '(%d+)-(%d+)')
+	if ams ~= bms then
+		return tonumber(ams) < tonumber(bms)
+	end
+	return tonumber(aseq) < tonumber(bseq)
+end
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	return {0, 0, 0, 0}
+end
+local length = redis.call('XLEN', KEYS[1])
+local target = ARGV[2]
+local maxLen = tonumber(ARGV[1])
+local step = tonumber(ARGV[4])
+local more = 0
+if maxLen > 0 and length > maxLen then
+	local excess = length - maxLen
+	if excess > step then
+		excess = step
+		more = 1
+	end
+	local entries = redis.call('XRANGE', KEYS[1], '-', '+', 'COUNT', excess + 1)
+	local cut = entries[#entries][1]
+	if target == '' or less(target, cut) then
+		target = cut
+	end
+end
+if target == '' then
+	return {0, 0, length, 0}
+end
+local floor
+for _, group in ipairs(redis.call('XINFO', 'GROUPS', KEYS[1])) do
+	local info = {}
+	for i = 1, #group, 2 do
+		info[group[i]] = group[i + 1]
+	end
+	local bound = info['last-delivered-id']
+	local pending = redis.call('XPENDING', KEYS[1], info['name'], '-', '+', 1)
+	if #pending > 0 and less(pending[1][1], bound) then
+		bound = pending[1][1]
+	end
+	if not floor or less(bound, floor) then
+		floor = bound
+	end
+end
+local blocked = 0
+if floor and less(floor, target) then
+	target = floor
+	blocked = 1
+end
+local head = redis.call('XRANGE', KEYS[1], '-', '+', 'COUNT', step + 1)
+if #head == step + 1 and less(head[step + 1][1], target) then
+	target = head[step + 1][1]
+	more = 1
+end
+local deleted
+if ARGV[3] == '1' then
+	deleted = redis.call('XTRIM', KEYS[1], 'MINID', '~', target)
+else
+	deleted = redis.call('XTRIM', KEYS[1], 'MINID', target)
+end
+return {deleted, blocked, redis.call('XLEN', KEYS[1]), more}
+`)
+
+// 安全裁剪时单次脚本最多裁剪的条数
+const safeTrimStep = 1000
+
+// Trimmer 后台定期按保留策略裁剪 topic，可以替代每次投递时裁剪，降低投递开销
+type Trimmer struct {
+	client *client.Client
+	// 生命周期管理
+	ctx  context.Context
+	stop context.CancelFunc
+	// 裁剪间隔
+	interval time.Duration
+	// 各 topic 的保留策略
+	retentions map[string]RetentionPolicy
+	opts       *TrimmerOptions
+}
+
+func NewTrimmer(rc *client.Client, interval time.Duration, retentions map[string]RetentionPolicy, opts ...TrimmerOption) (*Trimmer, error) {
+	if rc == nil {
+		return nil, errors.New("redis client can't be empty")
+	}
+	if interval <= 0 {
+		return nil, errors.New("trim interval must be positive")
+	}
+	for topic, retention := range retentions {
+		if topic == "" || retention.isZero() {
+			return nil, fmt.Errorf("invalid retention policy, topic: %s", topic)
+		}
+	}
+	ctx, stop := context.WithCancel(context.Background())
+	t := &Trimmer{
+		client:     rc,
+		ctx:        ctx,
+		stop:       stop,
+		interval:   interval,
+		retentions: retentions,
+		opts:       &TrimmerOptions{},
+	}
+	for _, opt := range opts {
+		opt(t.opts)
+	}
+	go t.run()
+	return t, nil
+}
+
+func (t *Trimmer) Stop() {
+	t.stop()
+}
+
+func (t *Trimmer) run() {
+	ticker := time.NewTicker(t.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-t.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		tctx, cancel := context.WithTimeout(t.ctx, t.interval)
+		t.TrimOnce(tctx)
+		cancel()
+	}
+}
+
+// TrimOnce 立即按保留策略裁剪所有 topic
+func (t *Trimmer) TrimOnce(ctx context.Context) {
+	now := time.Now()
+	for topic, retention := range t.retentions {
+		if retention.Safe {
+			t.safeTrim(ctx, topic, retention, now)
+			continue
+		}
+		for _, trim := range retention.trimArgs(now) {
+			deleted, err := t.client.XTRIM(ctx, topic, trim)
+			if err != nil {
+				log.GetDefaultLogger().Errorf("topic trim failed, topic: %s, err: %v", topic, err)
+				continue
+			}
+			if deleted > 0 {
+				log.GetDefaultLogger().Infof("topic trimmed, topic: %s, deleted: %d", topic, deleted)
+			}
+		}
+	}
+}
+
+func (t *Trimmer) safeTrim(ctx context.Context, topic string, retention RetentionPolicy, now time.Time) {
+	var minID string
+	if retention.MaxAge > 0 {
+		minID = msgIDFromTime(now.Add(-retention.MaxAge))
+	}
+	approx := 0
+	if retention.Approx {
+		approx = 1
+	}
+	for {
+		reply, err := safeTrimScript.RunInt64s(ctx, t.client, []string{topic}, retention.MaxLen, minID, approx, safeTrimStep)
+		if err != nil {
+			log.GetDefaultLogger().Errorf("topic safe trim failed, topic: %s, err: %v", topic, err)
+			return
+		}
+		if len(reply) != 4 {
+			log.GetDefaultLogger().Errorf("topic safe trim failed, topic: %s, err: %v", topic, client.ErrInvlidMsg)
+			return
+		}
+		deleted, blocked, length, more := reply[0], reply[1] == 1, reply[2], reply[3] == 1
+		if deleted > 0 {
+			log.GetDefaultLogger().Infof("topic trimmed, topic: %s, deleted: %d", topic, deleted)
+		}
+		if blocked {
+			log.GetDefaultLogger().Warnf("topic backlog exceeds retention, unconsumed messages are kept, topic: %s, length: %d", topic, length)
+			if t.opts.backlogObserver != nil {
+				t.opts.backlogObserver(topic, length)
+			}
+			return
+		}
+		// 近似裁剪可能一条都不删除，此时留到下一轮继续
+		if !more || deleted == 0 || ctx.Err() != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package MQ
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRetentionPolicy_trimArgs(t *testing.T) {
+	now := time.UnixMilli(1700000000000)
+	trims := RetentionPolicy{MaxLen: 100, MaxAge: time.Minute, Approx: true}.trimArgs(now)
+	if len(trims) != 2 {
+		t.Errorf("expect 2 trim args, got %d", len(trims))
+		return
+	}
+	if args := trims[0].Args(); len(args) != 3 || args[0] != "MINID" || args[1] != "~" || args[2] != "1699999940000-0" {
+		t.Errorf("unexpected minid args: %v", args)
+	}
+	if args := trims[1].Args(); len(args) != 3 || args[0] != "MAXLEN" || args[2] != int64(100) {
+		t.Errorf("unexpected maxlen args: %v", args)
+	}
+	if trims := (RetentionPolicy{}).trimArgs(now); len(trims) != 0 {
+		t.Errorf("expect no trim args, got %v", trims)
+	}
+}
+
+func TestRepairProducer_SafeRetention(t *testing.T) {
+	opts := &ProducerOptions{retention: RetentionPolicy{Safe: true}, trimOnSend: true}
+	repairProducer(opts)
+	p := &Producer{opts: opts}
+	if trims := p.sendTrimArgs(topic); len(trims) != 0 || !opts.retention.Safe {
+		t.Errorf("safe retention should not trim on send, got %v", trims)
+	}
+}
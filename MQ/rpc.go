@@ -0,0 +1,165 @@
+package MQ
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"github.com/orormaybe/RedisMQ/client"
+	"github.com/orormaybe/RedisMQ/log"
+	"sync"
+)
+
+const (
+	// 请求与响应的关联 id
+	HeaderCorrelationID = "x-correlation-id"
+	// 请求方接收响应的 topic
+	HeaderReplyTo = "x-reply-to"
+	// 服务方处理请求失败时返回的错误信息
+	HeaderRPCError = "x-rpc-error"
+)
+
+var ErrRPCClientClosed = errors.New("rpc client closed")
+
+// RPCError 服务方处理请求时返回的错误
+type RPCError struct {
+	Msg string
+}
+
+func (e *RPCError) Error() string {
+	return "rpc remote error: " + e.Msg
+}
+
+// RPCHandler 服务方处理请求的函数，返回的内容作为响应投递给请求方
+type RPCHandler func(ctx context.Context, msg *client.MsgEntity) (string, error)
+
+// NewRPCCallback 将 RPCHandler 包装为消费者的回调函数，可以用于 Consumer、PartitionedConsumer 等任意消费者。
+// handler 的返回值或错误会投递到请求指定的 reply topic；投递响应失败时回调返回错误，请求会按消费者的重试策略重新处理，
+// 因此 handler 需要保证幂等。没有指定 reply topic 的请求只执行 handler，不投递响应
+func NewRPCCallback(producer *Producer, handler RPCHandler) MsgCallback {
+	return func(ctx context.Context, msg *client.MsgEntity) error {
+		resp, err := handler(ctx, msg)
+		replyTo, correlationID := msg.Headers[HeaderReplyTo], msg.Headers[HeaderCorrelationID]
+		if replyTo == "" || correlationID == "" {
+			return err
+		}
+		headers := map[string]string{HeaderCorrelationID: correlationID}
+		if err != nil {
+			headers[HeaderRPCError] = err.Error()
+		}
+		_, sendErr := producer.SendMsgWithHeaders(ctx, replyTo, msg.Key, resp, headers)
+		return sendErr
+	}
+}
+
+// RPCClient 通过 topic 调用服务方并等待响应，每个实例需要使用独立的 reply topic，
+// 响应通过 BroadcastSubscriber 接收，opts 用于调整其接收参数
+type RPCClient struct {
+	producer *Producer
+	// 接收响应的 topic
+	replyTopic string
+	// 订阅 reply topic 的广播订阅者
+	subscriber *BroadcastSubscriber
+	// 等待响应的请求，key 为关联 id
+	mu    sync.Mutex
+	calls map[string]chan *client.MsgEntity
+	// Close 之后不再投递新的请求
+	closed bool
+}
+
+func NewRPCClient(rc *client.Client, producer *Producer, replyTopic string, opts ...BroadcastOption) (*RPCClient, error) {
+	if producer == nil {
+		return nil, errors.New("producer can't be empty")
+	}
+	r := &RPCClient{
+		producer:   producer,
+		replyTopic: replyTopic,
+		calls:      make(map[string]chan *client.MsgEntity),
+	}
+	subscriber, err := NewBroadcastSubscriber(rc, replyTopic, r.onReply, opts...)
+	if err != nil {
+		return nil, err
+	}
+	r.subscriber = subscriber
+	return r, nil
+}
+
+// Close 停止接收响应，之后调用 Call 会返回 ErrRPCClientClosed
+func (r *RPCClient) Close() {
+	r.mu.Lock()
+	r.closed = true
+	r.mu.Unlock()
+	r.subscriber.Stop()
+}
+
+// Call 向 topic 投递请求，并阻塞等待服务方的响应，直到 ctx 结束。服务方返回错误时返回 *RPCError
+func (r *RPCClient) Call(ctx context.Context, topic, key, val string) (*client.MsgEntity, error) {
+	correlationID, err := newCorrelationID()
+	if err != nil {
+		return nil, err
+	}
+	ch := make(chan *client.MsgEntity, 1)
+	r.mu.Lock()
+	// 订阅已经停止时投递的请求永远收不到响应
+	if r.closed {
+		r.mu.Unlock()
+		return nil, ErrRPCClientClosed
+	}
+	select {
+	case <-r.subscriber.Done():
+		r.mu.Unlock()
+		return nil, ErrRPCClientClosed
+	default:
+	}
+	r.calls[correlationID] = ch
+	r.mu.Unlock()
+	defer func() {
+		r.mu.Lock()
+		delete(r.calls, correlationID)
+		r.mu.Unlock()
+	}()
+
+	headers := map[string]string{
+		HeaderCorrelationID: correlationID,
+		HeaderReplyTo:       r.replyTopic,
+	}
+	if _, err := r.producer.SendMsgWithHeaders(ctx, topic, key, val, headers); err != nil {
+		return nil, err
+	}
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-r.subscriber.Done():
+		return nil, ErrRPCClientClosed
+	case reply := <-ch:
+		if errMsg, ok := reply.Headers[HeaderRPCError]; ok {
+			return reply, &RPCError{Msg: errMsg}
+		}
+		return reply, nil
+	}
+}
+
+func (r *RPCClient) onReply(ctx context.Context, msg *client.MsgEntity) error {
+	correlationID := msg.Headers[HeaderCorrelationID]
+	r.mu.Lock()
+	ch, ok := r.calls[correlationID]
+	r.mu.Unlock()
+	if !ok {
+		// 请求已超时返回，或者是其他实例的响应
+		log.GetDefaultLogger().Warnf("rpc reply discarded, topic: %s, correlation id: %s", r.replyTopic, correlationID)
+		return nil
+	}
+	select {
+	case ch <- msg:
+	default:
+	}
+	return nil
+}
+
+func newCorrelationID() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
@@ -0,0 +1,43 @@
+package MQ
+
+import (
+	"context"
+	"github.com/orormaybe/RedisMQ/client"
+	"testing"
+	"time"
+)
+
+func TestContextWithHeaders(t *testing.T) {
+	ctx := ContextWithHeaders(context.Background(), map[string]string{"h1": "v1", "h2": "v2"})
+	ctx = ContextWithHeaders(ctx, map[string]string{"h2": "v3"})
+	if headers := HeadersFromContext(ctx); len(headers) != 2 || headers["h1"] != "v1" || headers["h2"] != "v3" {
+		t.Errorf("unexpected headers: %v", headers)
+	}
+}
+
+func TestRPCClient_Call(t *testing.T) {
+	c := client.NewClient(network, address, password)
+	producer := NewProducer(c)
+	server, err := NewConsumer(c, topic, consumerGroup, consumerID, NewRPCCallback(producer, func(ctx context.Context, msg *client.MsgEntity) (string, error) {
+		return "reply:" + msg.Val, nil
+	}))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer server.Stop()
+	rpcClient, err := NewRPCClient(c, producer, topic+":reply")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer rpcClient.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	reply, err := rpcClient.Call(ctx, topic, "test_k", "test_v")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	t.Logf("receive reply, msg key: %s, msg val: %s", reply.Key, reply.Val)
+}
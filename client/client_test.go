@@ -76,3 +76,74 @@ func TestXReadGroup(t *testing.T) {
 	t.Log(reply)
 
 }
+
+func TestXReadGroupMulti(t *testing.T) {
+	client := NewClient(network, address, password)
+	reply, err := client.XReadGroupMulti(context.Background(), "gr20", "cu1", []string{"test7", "test8"}, 20000)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	for _, a_reply := range reply {
+		t.Log(*a_reply)
+	}
+}
+
+func TestXRange(t *testing.T) {
+	client := NewClient(network, address, password)
+	reply, err := client.XRange(context.Background(), "test7", "-", "+", 10)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	for _, a_reply := range reply {
+		t.Log(*a_reply)
+	}
+}
+
+func TestParseMsgs_Headers(t *testing.T) {
+	msgs, _, err := parseMsgs([]interface{}{
+		[]interface{}{[]byte("1-0"), []interface{}{[]byte("key1"), []byte("val1")}},
+		[]interface{}{[]byte("2-0"), []interface{}{[]byte("key2"), []byte("val2"), []byte("h1"), []byte("v1")}},
+	})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(msgs) != 2 || msgs[0].Headers != nil || msgs[1].Headers["h1"] != "v1" {
+		t.Errorf("unexpected msgs: %v, %v", *msgs[0], *msgs[1])
+	}
+	if _, _, err := parseMsgs([]interface{}{[]interface{}{[]byte("3-0"), []interface{}{[]byte("key3"), []byte("val3"), []byte("h1")}}}); err == nil {
+		t.Error("odd msg body should fail")
+	}
+}
+
+func TestParseMsgs_Deleted(t *testing.T) {
+	msgs, deletedIDs, err := parseMsgs([]interface{}{
+		[]interface{}{[]byte("1-0"), nil},
+		[]interface{}{[]byte("2-0"), []interface{}{[]byte("key2"), []byte("val2")}},
+	})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(msgs) != 1 || msgs[0].MsgID != "2-0" || len(deletedIDs) != 1 || deletedIDs[0] != "1-0" {
+		t.Errorf("unexpected parse result, msgs: %d, deleted ids: %v", len(msgs), deletedIDs)
+	}
+}
+
+func TestParseStreams_Deleted(t *testing.T) {
+	msgs, deleted, err := parseStreams([]interface{}{
+		[]interface{}{[]byte("test8"), []interface{}{
+			[]interface{}{[]byte("1-0"), nil},
+			[]interface{}{[]byte("2-0"), []interface{}{[]byte("key2"), []byte("val2")}},
+		}},
+	})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(msgs) != 1 || msgs[0].Topic != "test8" || len(deleted["test8"]) != 1 || deleted["test8"][0] != "1-0" {
+		t.Errorf("unexpected parse result, msgs: %d, deleted: %v", len(msgs), deleted)
+	}
+}
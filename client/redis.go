@@ -13,10 +13,48 @@ import (
 var ErrNoMsg = errors.New("no msg received")
 var ErrInvlidMsg = errors.New("invalid msg format")
 
+// ErrMsgNotPending XACK 的消息不在 pending list 中，通常是消息已经被 ack
+var ErrMsgNotPending = errors.New("msg not pending")
+
 type MsgEntity struct {
+	// 消息所属的 topic
+	Topic string
 	MsgID string
 	Key   string
 	Val   string
+	// 消息头，保存在消息体中 key / val 之后的字段
+	Headers map[string]string
+}
+
+// PendingMsg 已投递给消费者但尚未 ack 的消息
+type PendingMsg struct {
+	MsgID string
+	// 当前持有该消息的消费者
+	Consumer string
+	// 距离上次投递的时长，单位毫秒
+	IdleMs int64
+	// 累计投递次数
+	DeliveryCnt int64
+}
+
+// GroupInfo 消费者组信息
+type GroupInfo struct {
+	Name string
+	// 组内消费者数量
+	Consumers int64
+	// 已投递但尚未 ack 的消息数量
+	Pending int64
+	// 最后一条投递给该组的消息 id
+	LastDeliveredID string
+}
+
+// ConsumerInfo 消费者组内的消费者信息
+type ConsumerInfo struct {
+	Name string
+	// 已投递给该消费者但尚未 ack 的消息数量
+	Pending int64
+	// 距离该消费者上次与 redis 交互的时长，单位毫秒
+	IdleMs int64
 }
 
 type Client struct {
@@ -100,6 +138,76 @@ func (c *Client) XADD(ctx context.Context, topic string, maxLen int, key, val st
 	return redis.String(conn.Do("XADD", topic, "MAXLEN", maxLen, "*", key, val))
 }
 
+// TrimArgs stream 裁剪参数，MaxLen 与 MinID 同时设置时使用 MinID
+type TrimArgs struct {
+	// 按长度裁剪，只保留最新的 MaxLen 条消息
+	MaxLen int64
+	// 按 id 裁剪，删除 id 小于 MinID 的消息，可用于按时间保留
+	MinID string
+	// 近似裁剪（~），redis 只在能够整块删除内部节点时才裁剪，开销更低，实际保留的消息可能略多
+	Approx bool
+}
+
+// Args 返回 XADD / XTRIM 命令中的裁剪参数，未设置裁剪条件时返回 nil
+func (t *TrimArgs) Args() []interface{} {
+	if t == nil {
+		return nil
+	}
+	var args []interface{}
+	switch {
+	case t.MinID != "":
+		args = append(args, "MINID")
+	case t.MaxLen > 0:
+		args = append(args, "MAXLEN")
+	default:
+		return nil
+	}
+	if t.Approx {
+		args = append(args, "~")
+	}
+	if t.MinID != "" {
+		return append(args, t.MinID)
+	}
+	return append(args, t.MaxLen)
+}
+
+// XADDWithTrim 投递消息并按 trim 裁剪 stream，trim 为 nil 时不裁剪
+func (c *Client) XADDWithTrim(ctx context.Context, topic string, trim *TrimArgs, key, val string) (string, error) {
+	return c.XADDWithHeaders(ctx, topic, trim, key, val, nil)
+}
+
+// XADDWithHeaders 投递带消息头的消息，消息头保存在消息体中 key / val 之后的字段中
+func (c *Client) XADDWithHeaders(ctx context.Context, topic string, trim *TrimArgs, key, val string, headers map[string]string) (string, error) {
+	if topic == "" {
+		return "", errors.New("redis XADD topic can't be empty")
+	}
+	conn, err := c.pool.GetContext(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	args := append([]interface{}{topic}, trim.Args()...)
+	args = append(args, "*", key, val)
+	for headerKey, headerVal := range headers {
+		args = append(args, headerKey, headerVal)
+	}
+	return redis.String(conn.Do("XADD", args...))
+}
+
+// XTRIM 按 trim 裁剪 stream，返回删除的消息数量
+func (c *Client) XTRIM(ctx context.Context, topic string, trim *TrimArgs) (int64, error) {
+	trimArgs := trim.Args()
+	if topic == "" || len(trimArgs) == 0 {
+		return -1, errors.New("redis XTRIM topic | trim args can't be empty")
+	}
+	conn, err := c.pool.GetContext(ctx)
+	if err != nil {
+		return -1, err
+	}
+	defer conn.Close()
+	return redis.Int64(conn.Do("XTRIM", append([]interface{}{topic}, trimArgs...)...))
+}
+
 func (c *Client) XACK(ctx context.Context, topic, groupID, msgID string) error {
 	if topic == "" || groupID == "" || msgID == "" {
 		return errors.New("redis XACK topic | group_id | msg_ id can't be empty")
@@ -113,6 +221,9 @@ func (c *Client) XACK(ctx context.Context, topic, groupID, msgID string) error {
 	if err != nil {
 		return err
 	}
+	if reply == 0 {
+		return ErrMsgNotPending
+	}
 	if reply != 1 {
 		return fmt.Errorf("invalid reply: %d", reply)
 	}
@@ -128,62 +239,217 @@ func (c *Client) XGroupCreate(ctx context.Context, topic, group string) (string,
 	return redis.String(conn.Do("XGROUP", "CREATE", topic, group, "0-0"))
 }
 
-func (c *Client) xReadGroup(ctx context.Context, groupID, consumerID, topic string, timeoutMiliSeconds int, pending bool) ([]*MsgEntity, error) {
-	if groupID == "" || consumerID == "" || topic == "" {
-		return nil, errors.New("redis XREADGROUP groupID/consumerID/topic can't be empty")
+// count <= 0 时不限制每个 topic 读取的条数；读取新消息时 timeoutMiliSeconds < 0 表示不阻塞，没有新消息时立即返回 ErrNoMsg
+// 读取 pending list 时，同时返回各 topic 中已被裁剪或删除、无法再处理的消息 id
+func (c *Client) xReadGroup(ctx context.Context, groupID, consumerID string, topics []string, count, timeoutMiliSeconds int, pending bool) ([]*MsgEntity, map[string][]string, error) {
+	if groupID == "" || consumerID == "" || len(topics) == 0 {
+		return nil, nil, errors.New("redis XREADGROUP groupID/consumerID/topic can't be empty")
+	}
+	args := []interface{}{"GROUP", groupID, consumerID}
+	if count > 0 {
+		args = append(args, "COUNT", count)
+	}
+	if !pending && timeoutMiliSeconds >= 0 {
+		args = append(args, "BLOCK", timeoutMiliSeconds)
+	}
+	args = append(args, "STREAMS")
+	for _, topic := range topics {
+		if topic == "" {
+			return nil, nil, errors.New("redis XREADGROUP groupID/consumerID/topic can't be empty")
+		}
+		args = append(args, topic)
+	}
+	for range topics {
+		if pending {
+			args = append(args, "0-0")
+		} else {
+			args = append(args, ">")
+		}
 	}
 	conn, err := c.pool.GetContext(ctx)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	defer conn.Close()
-	var rawReply any
-	if pending {
-		rawReply, err = conn.Do("XREADGROUP", "GROUP", groupID, consumerID, "STREAMS", topic, "0-0")
-	} else {
-		rawReply, err = conn.Do("XREADGROUP", "GROUP", groupID, consumerID, "BLOCK", timeoutMiliSeconds, "STREAMS", topic, ">")
-	}
+	rawReply, err := conn.Do("XREADGROUP", args...)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
+	return parseStreams(rawReply)
+}
+
+// 解析 XREAD / XREADGROUP 的结果，每个 stream 的结果格式为 [topic, [msg...]]，同时返回各 topic 中已被删除的消息 id
+func parseStreams(rawReply interface{}) ([]*MsgEntity, map[string][]string, error) {
 	reply, _ := rawReply.([]any)
 	if len(reply) == 0 {
-		return nil, ErrNoMsg
-	}
-	replyElement, _ := reply[0].([]interface{})
-	if len(replyElement) != 2 {
-		return nil, ErrInvlidMsg
+		return nil, nil, ErrNoMsg
 	}
 	var msgs []*MsgEntity
-	rawMsgs, _ := replyElement[1].([]interface{})
+	var deleted map[string][]string
+	for _, rawElement := range reply {
+		replyElement, _ := rawElement.([]interface{})
+		if len(replyElement) != 2 {
+			return nil, nil, ErrInvlidMsg
+		}
+		topic := gocast.ToString(replyElement[0])
+		rawMsgs, _ := replyElement[1].([]interface{})
+		topicMsgs, deletedIDs, err := parseMsgs(rawMsgs)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, msg := range topicMsgs {
+			msg.Topic = topic
+		}
+		msgs = append(msgs, topicMsgs...)
+		if len(deletedIDs) > 0 {
+			if deleted == nil {
+				deleted = make(map[string][]string)
+			}
+			deleted[topic] = deletedIDs
+		}
+	}
+	return msgs, deleted, nil
+}
+
+// 解析 stream 中的消息列表，每条消息的格式为 [msg_id, [key, val, header_key, header_val...]]
+// 读取 pending list 时，已被删除的消息内容为 nil，这些消息不会返回，而是通过 deletedIDs 返回其 id
+func parseMsgs(rawMsgs []interface{}) (msgs []*MsgEntity, deletedIDs []string, err error) {
 	for _, rawMsg := range rawMsgs {
 		_msg, _ := rawMsg.([]interface{})
 		if len(_msg) != 2 {
-			return nil, ErrInvlidMsg
+			return nil, nil, ErrInvlidMsg
 		}
 		msgID := gocast.ToString(_msg[0])
+		if _msg[1] == nil {
+			deletedIDs = append(deletedIDs, msgID)
+			continue
+		}
 		msgBody, _ := _msg[1].([]interface{})
-		if len(msgBody) != 2 {
-			return nil, ErrInvlidMsg
+		if len(msgBody) < 2 || len(msgBody)%2 != 0 {
+			return nil, nil, ErrInvlidMsg
 		}
 		msgKey := gocast.ToString(msgBody[0])
 		msgVal := gocast.ToString(msgBody[1])
+		var headers map[string]string
+		if len(msgBody) > 2 {
+			headers = make(map[string]string, len(msgBody)/2-1)
+			for i := 2; i < len(msgBody); i += 2 {
+				headers[gocast.ToString(msgBody[i])] = gocast.ToString(msgBody[i+1])
+			}
+		}
 		msgs = append(msgs, &MsgEntity{
-			MsgID: msgID,
-			Key:   msgKey,
-			Val:   msgVal,
+			MsgID:   msgID,
+			Key:     msgKey,
+			Val:     msgVal,
+			Headers: headers,
 		})
 
 	}
-	return msgs, nil
-
+	return msgs, deletedIDs, nil
 }
+
+// XReadGroupPending 读取 topic 中已投递给当前消费者但尚未 ack 的消息，已被删除的消息不会返回
 func (c *Client) XReadGroupPending(ctx context.Context, groupID, consumerID, topic string) ([]*MsgEntity, error) {
-	return c.xReadGroup(ctx, groupID, consumerID, topic, 0, true)
+	msgs, _, err := c.xReadGroup(ctx, groupID, consumerID, []string{topic}, 0, 0, true)
+	return msgs, err
 }
 
 func (c *Client) XReadGroup(ctx context.Context, groupID, consumerID, topic string, timeoutMiliSeconds int) ([]*MsgEntity, error) {
-	return c.xReadGroup(ctx, groupID, consumerID, topic, timeoutMiliSeconds, false)
+	msgs, _, err := c.xReadGroup(ctx, groupID, consumerID, []string{topic}, 0, timeoutMiliSeconds, false)
+	return msgs, err
+}
+
+// XReadGroupPendingMulti 一次性读取多个 topic 中已投递给当前消费者但尚未 ack 的消息，
+// deleted 为各 topic 中仍在 pending list 但已被裁剪或删除的消息 id，需要由调用方 ack
+func (c *Client) XReadGroupPendingMulti(ctx context.Context, groupID, consumerID string, topics []string) (msgs []*MsgEntity, deleted map[string][]string, err error) {
+	return c.xReadGroup(ctx, groupID, consumerID, topics, 0, 0, true)
+}
+
+// XReadGroupMulti 通过一次阻塞的 XREADGROUP 同时读取多个 topic 的新消息，消息的 Topic 字段标识其来源
+func (c *Client) XReadGroupMulti(ctx context.Context, groupID, consumerID string, topics []string, timeoutMiliSeconds int) ([]*MsgEntity, error) {
+	msgs, _, err := c.xReadGroup(ctx, groupID, consumerID, topics, 0, timeoutMiliSeconds, false)
+	return msgs, err
+}
+
+// XReadGroupN 与 XReadGroupMulti 相同，但每个 topic 最多读取 count 条，count <= 0 时不限制条数；
+// timeoutMiliSeconds < 0 时不阻塞，没有新消息时立即返回 ErrNoMsg
+func (c *Client) XReadGroupN(ctx context.Context, groupID, consumerID string, topics []string, count, timeoutMiliSeconds int) ([]*MsgEntity, error) {
+	msgs, _, err := c.xReadGroup(ctx, groupID, consumerID, topics, count, timeoutMiliSeconds, false)
+	return msgs, err
+}
+
+// XRange 按 id 升序返回 [start, end] 区间内的消息，start / end 可以使用 "-" / "+" 表示最早 / 最新，
+// 以 "(" 开头表示不包含该 id，count <= 0 时不限制条数
+func (c *Client) XRange(ctx context.Context, topic, start, end string, count int) ([]*MsgEntity, error) {
+	return c.xRange(ctx, "XRANGE", topic, start, end, count)
+}
+
+// XRevRange 按 id 降序返回 [start, end] 区间内的消息，注意参数顺序与 XREVRANGE 命令一致，先 end 后 start
+func (c *Client) XRevRange(ctx context.Context, topic, end, start string, count int) ([]*MsgEntity, error) {
+	return c.xRange(ctx, "XREVRANGE", topic, end, start, count)
+}
+
+func (c *Client) xRange(ctx context.Context, command, topic, from, to string, count int) ([]*MsgEntity, error) {
+	if topic == "" || from == "" || to == "" {
+		return nil, fmt.Errorf("redis %s topic | start | end can't be empty", command)
+	}
+	conn, err := c.pool.GetContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	args := []interface{}{topic, from, to}
+	if count > 0 {
+		args = append(args, "COUNT", count)
+	}
+	rawMsgs, err := redis.Values(conn.Do(command, args...))
+	if err != nil {
+		return nil, err
+	}
+	msgs, _, err := parseMsgs(rawMsgs)
+	if err != nil {
+		return nil, err
+	}
+	for _, msg := range msgs {
+		msg.Topic = topic
+	}
+	return msgs, nil
+}
+
+// XRead 不通过消费者组读取多个 topic 中 id 大于 ids 中对应 id 的消息，ids 与 topics 一一对应，可以使用 "$" 表示只读取新消息。
+// timeoutMiliSeconds > 0 时阻塞等待，超时未读到消息时返回 ErrNoMsg；count <= 0 时不限制条数
+func (c *Client) XRead(ctx context.Context, topics, ids []string, count, timeoutMiliSeconds int) ([]*MsgEntity, error) {
+	if len(topics) == 0 || len(topics) != len(ids) {
+		return nil, errors.New("redis XREAD topics can't be empty and must match ids")
+	}
+	var args []interface{}
+	if count > 0 {
+		args = append(args, "COUNT", count)
+	}
+	if timeoutMiliSeconds > 0 {
+		args = append(args, "BLOCK", timeoutMiliSeconds)
+	}
+	args = append(args, "STREAMS")
+	for _, topic := range topics {
+		if topic == "" {
+			return nil, errors.New("redis XREAD topic can't be empty")
+		}
+		args = append(args, topic)
+	}
+	for _, id := range ids {
+		args = append(args, id)
+	}
+	conn, err := c.pool.GetContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	rawReply, err := conn.Do("XREAD", args...)
+	if err != nil {
+		return nil, err
+	}
+	msgs, _, err := parseStreams(rawReply)
+	return msgs, err
 }
 
 func (c *Client) Get(ctx context.Context, key string) (string, error) {
@@ -281,3 +547,526 @@ func (c *Client) Incr(ctx context.Context, key string) (int64, error) {
 	defer conn.Close()
 	return redis.Int64(conn.Do("INCR", key))
 }
+
+func (c *Client) XGroupCreateMkStream(ctx context.Context, topic, group string) (string, error) {
+	if topic == "" || group == "" {
+		return "", errors.New("redis XGROUP CREATE topic | group can't be empty")
+	}
+	conn, err := c.pool.GetContext(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	return redis.String(conn.Do("XGROUP", "CREATE", topic, group, "0-0", "MKSTREAM"))
+}
+
+func (c *Client) SetNXEX(ctx context.Context, key, value string, expireSeconds int64) (int64, error) {
+	if key == "" || value == "" {
+		return -1, errors.New("redis SET keyNX or value can't be empty")
+	}
+	conn, err := c.pool.GetContext(ctx)
+	if err != nil {
+		return -1, err
+	}
+	defer conn.Close()
+	reply, err := conn.Do("SET", key, value, "EX", expireSeconds, "NX")
+	if err != nil {
+		return -1, err
+	}
+	// key 已存在时返回 nil
+	if reply == nil {
+		return 0, nil
+	}
+	if replyStr, ok := reply.(string); ok && strings.ToLower(replyStr) == "ok" {
+		return 1, nil
+	}
+	return redis.Int64(reply, err)
+}
+
+func (c *Client) SetNXPX(ctx context.Context, key, value string, expireMilliSeconds int64) (int64, error) {
+	if key == "" || value == "" {
+		return -1, errors.New("redis SET keyNX or value can't be empty")
+	}
+	conn, err := c.pool.GetContext(ctx)
+	if err != nil {
+		return -1, err
+	}
+	defer conn.Close()
+	reply, err := conn.Do("SET", key, value, "PX", expireMilliSeconds, "NX")
+	if err != nil {
+		return -1, err
+	}
+	// key 已存在时返回 nil
+	if reply == nil {
+		return 0, nil
+	}
+	if replyStr, ok := reply.(string); ok && strings.ToLower(replyStr) == "ok" {
+		return 1, nil
+	}
+	return redis.Int64(reply, err)
+}
+
+// CompareAndExpire 仅当 key 当前的值等于 value 时才刷新其过期时间，基于 WATCH/MULTI 实现乐观锁
+func (c *Client) CompareAndExpire(ctx context.Context, key, value string, expireSeconds int64) (bool, error) {
+	if key == "" || value == "" {
+		return false, errors.New("redis EXPIRE key or value can't be empty")
+	}
+	return c.compareAndDo(ctx, key, value, "EXPIRE", key, expireSeconds)
+}
+
+// CompareAndDel 仅当 key 当前的值等于 value 时才删除 key，基于 WATCH/MULTI 实现乐观锁
+func (c *Client) CompareAndDel(ctx context.Context, key, value string) (bool, error) {
+	if key == "" || value == "" {
+		return false, errors.New("redis DEL key or value can't be empty")
+	}
+	return c.compareAndDo(ctx, key, value, "DEL", key)
+}
+
+func (c *Client) compareAndDo(ctx context.Context, key, value, command string, args ...interface{}) (bool, error) {
+	conn, err := c.pool.GetContext(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+	if _, err = conn.Do("WATCH", key); err != nil {
+		return false, err
+	}
+	current, err := redis.String(conn.Do("GET", key))
+	if err != nil && !errors.Is(err, redis.ErrNil) {
+		_, _ = conn.Do("UNWATCH")
+		return false, err
+	}
+	if current != value {
+		_, err = conn.Do("UNWATCH")
+		return false, err
+	}
+	if err = conn.Send("MULTI"); err != nil {
+		return false, err
+	}
+	if err = conn.Send(command, args...); err != nil {
+		return false, err
+	}
+	reply, err := redis.Values(conn.Do("EXEC"))
+	if errors.Is(err, redis.ErrNil) {
+		// 事务执行前 key 被其他客户端修改
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return len(reply) == 1, nil
+}
+
+func (c *Client) ZAdd(ctx context.Context, key string, score int64, member string) (int64, error) {
+	if key == "" || member == "" {
+		return -1, errors.New("redis ZADD key or member can't be empty")
+	}
+	conn, err := c.pool.GetContext(ctx)
+	if err != nil {
+		return -1, err
+	}
+	defer conn.Close()
+	return redis.Int64(conn.Do("ZADD", key, score, member))
+}
+
+func (c *Client) ZRem(ctx context.Context, key, member string) (int64, error) {
+	if key == "" || member == "" {
+		return -1, errors.New("redis ZREM key or member can't be empty")
+	}
+	conn, err := c.pool.GetContext(ctx)
+	if err != nil {
+		return -1, err
+	}
+	defer conn.Close()
+	return redis.Int64(conn.Do("ZREM", key, member))
+}
+
+func (c *Client) ZRangeByScore(ctx context.Context, key string, min, max int64) ([]string, error) {
+	if key == "" {
+		return nil, errors.New("redis ZRANGEBYSCORE key can't be empty")
+	}
+	conn, err := c.pool.GetContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	return redis.Strings(conn.Do("ZRANGEBYSCORE", key, min, max))
+}
+
+func (c *Client) ZRemRangeByScore(ctx context.Context, key string, min, max int64) (int64, error) {
+	if key == "" {
+		return -1, errors.New("redis ZREMRANGEBYSCORE key can't be empty")
+	}
+	conn, err := c.pool.GetContext(ctx)
+	if err != nil {
+		return -1, err
+	}
+	defer conn.Close()
+	return redis.Int64(conn.Do("ZREMRANGEBYSCORE", key, min, max))
+}
+
+// XPending 返回消费者组内各消费者未 ack 的消息数量
+func (c *Client) XPending(ctx context.Context, topic, group string) (map[string]int64, error) {
+	if topic == "" || group == "" {
+		return nil, errors.New("redis XPENDING topic | group can't be empty")
+	}
+	conn, err := c.pool.GetContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	reply, err := redis.Values(conn.Do("XPENDING", topic, group))
+	if err != nil {
+		return nil, err
+	}
+	if len(reply) != 4 {
+		return nil, ErrInvlidMsg
+	}
+	rawConsumers, _ := reply[3].([]interface{})
+	pendings := make(map[string]int64, len(rawConsumers))
+	for _, rawConsumer := range rawConsumers {
+		_consumer, _ := rawConsumer.([]interface{})
+		if len(_consumer) != 2 {
+			return nil, ErrInvlidMsg
+		}
+		pendings[gocast.ToString(_consumer[0])] = gocast.ToInt64(_consumer[1])
+	}
+	return pendings, nil
+}
+
+// XPendingRange 返回消费者未 ack 的消息明细，consumer 为空时返回整个消费者组的
+func (c *Client) XPendingRange(ctx context.Context, topic, group, consumer string, count int) ([]*PendingMsg, error) {
+	if topic == "" || group == "" {
+		return nil, errors.New("redis XPENDING topic | group can't be empty")
+	}
+	conn, err := c.pool.GetContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	args := []interface{}{topic, group, "-", "+", count}
+	if consumer != "" {
+		args = append(args, consumer)
+	}
+	reply, err := redis.Values(conn.Do("XPENDING", args...))
+	if err != nil {
+		return nil, err
+	}
+	pendings := make([]*PendingMsg, 0, len(reply))
+	for _, rawPending := range reply {
+		_pending, _ := rawPending.([]interface{})
+		if len(_pending) != 4 {
+			return nil, ErrInvlidMsg
+		}
+		pendings = append(pendings, &PendingMsg{
+			MsgID:       gocast.ToString(_pending[0]),
+			Consumer:    gocast.ToString(_pending[1]),
+			IdleMs:      gocast.ToInt64(_pending[2]),
+			DeliveryCnt: gocast.ToInt64(_pending[3]),
+		})
+	}
+	return pendings, nil
+}
+
+// XClaim 将空闲时长超过 minIdleMs 的未 ack 消息转移给 consumer，返回成功转移的消息
+func (c *Client) XClaim(ctx context.Context, topic, group, consumer string, minIdleMs int64, msgIDs ...string) ([]*MsgEntity, error) {
+	if topic == "" || group == "" || consumer == "" {
+		return nil, errors.New("redis XCLAIM topic | group | consumer can't be empty")
+	}
+	if len(msgIDs) == 0 {
+		return nil, nil
+	}
+	conn, err := c.pool.GetContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	args := []interface{}{topic, group, consumer, minIdleMs}
+	for _, msgID := range msgIDs {
+		args = append(args, msgID)
+	}
+	reply, err := redis.Values(conn.Do("XCLAIM", args...))
+	if err != nil {
+		return nil, err
+	}
+	// 已被删除的消息会以 nil 返回，直接忽略
+	rawMsgs := make([]interface{}, 0, len(reply))
+	for _, rawMsg := range reply {
+		if rawMsg != nil {
+			rawMsgs = append(rawMsgs, rawMsg)
+		}
+	}
+	msgs, _, err := parseMsgs(rawMsgs)
+	if err != nil {
+		return nil, err
+	}
+	for _, msg := range msgs {
+		msg.Topic = topic
+	}
+	return msgs, nil
+}
+
+// Scan 按 match 模式增量遍历 key，keyType 非空时只返回对应类型的 key，返回下一轮遍历的游标，游标为 0 时表示遍历结束
+func (c *Client) Scan(ctx context.Context, cursor int64, match, keyType string, count int) (int64, []string, error) {
+	conn, err := c.pool.GetContext(ctx)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer conn.Close()
+	args := []interface{}{cursor}
+	if match != "" {
+		args = append(args, "MATCH", match)
+	}
+	if count > 0 {
+		args = append(args, "COUNT", count)
+	}
+	if keyType != "" {
+		args = append(args, "TYPE", keyType)
+	}
+	reply, err := redis.Values(conn.Do("SCAN", args...))
+	if err != nil {
+		return 0, nil, err
+	}
+	if len(reply) != 2 {
+		return 0, nil, ErrInvlidMsg
+	}
+	keys, err := redis.Strings(reply[1], nil)
+	if err != nil {
+		return 0, nil, err
+	}
+	return gocast.ToInt64(reply[0]), keys, nil
+}
+
+func (c *Client) Eval(ctx context.Context, script string, keys []string, args ...interface{}) (interface{}, error) {
+	if script == "" {
+		return nil, errors.New("redis EVAL script can't be empty")
+	}
+	return c.eval(ctx, "EVAL", script, keys, args...)
+}
+
+func (c *Client) EvalSha(ctx context.Context, sha string, keys []string, args ...interface{}) (interface{}, error) {
+	if sha == "" {
+		return nil, errors.New("redis EVALSHA sha can't be empty")
+	}
+	return c.eval(ctx, "EVALSHA", sha, keys, args...)
+}
+
+func (c *Client) eval(ctx context.Context, command, script string, keys []string, args ...interface{}) (interface{}, error) {
+	conn, err := c.pool.GetContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	cmdArgs := make([]interface{}, 0, 2+len(keys)+len(args))
+	cmdArgs = append(cmdArgs, script, len(keys))
+	for _, key := range keys {
+		cmdArgs = append(cmdArgs, key)
+	}
+	cmdArgs = append(cmdArgs, args...)
+	return conn.Do(command, cmdArgs...)
+}
+
+// ScriptLoad 将脚本缓存到 redis 中，返回脚本的 sha1
+func (c *Client) ScriptLoad(ctx context.Context, script string) (string, error) {
+	if script == "" {
+		return "", errors.New("redis SCRIPT LOAD script can't be empty")
+	}
+	conn, err := c.pool.GetContext(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	return redis.String(conn.Do("SCRIPT", "LOAD", script))
+}
+
+// XGroupSetID 将消费者组的 last-delivered-id 设置为 id，可以使用 "$" 表示最新一条消息。
+// 之后组内只会读取到 id 之后的消息，不会影响已投递但尚未 ack 的消息
+func (c *Client) XGroupSetID(ctx context.Context, topic, group, id string) error {
+	if topic == "" || group == "" || id == "" {
+		return errors.New("redis XGROUP SETID topic | group | id can't be empty")
+	}
+	conn, err := c.pool.GetContext(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = redis.String(conn.Do("XGROUP", "SETID", topic, group, id))
+	return err
+}
+
+// XInfoGroups 返回 topic 上所有消费者组的信息
+func (c *Client) XInfoGroups(ctx context.Context, topic string) ([]*GroupInfo, error) {
+	if topic == "" {
+		return nil, errors.New("redis XINFO GROUPS topic can't be empty")
+	}
+	conn, err := c.pool.GetContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	reply, err := redis.Values(conn.Do("XINFO", "GROUPS", topic))
+	if err != nil {
+		return nil, err
+	}
+	groups := make([]*GroupInfo, 0, len(reply))
+	for _, rawGroup := range reply {
+		// 每个消费者组的信息格式为 [field, value, field, value...]
+		fields, _ := rawGroup.([]interface{})
+		if len(fields)%2 != 0 {
+			return nil, ErrInvlidMsg
+		}
+		group := &GroupInfo{}
+		for i := 0; i < len(fields); i += 2 {
+			switch gocast.ToString(fields[i]) {
+			case "name":
+				group.Name = gocast.ToString(fields[i+1])
+			case "consumers":
+				group.Consumers = gocast.ToInt64(fields[i+1])
+			case "pending":
+				group.Pending = gocast.ToInt64(fields[i+1])
+			case "last-delivered-id":
+				group.LastDeliveredID = gocast.ToString(fields[i+1])
+			}
+		}
+		groups = append(groups, group)
+	}
+	return groups, nil
+}
+
+// XInfoConsumers 返回消费者组内所有消费者的信息
+func (c *Client) XInfoConsumers(ctx context.Context, topic, group string) ([]*ConsumerInfo, error) {
+	if topic == "" || group == "" {
+		return nil, errors.New("redis XINFO CONSUMERS topic | group can't be empty")
+	}
+	conn, err := c.pool.GetContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	reply, err := redis.Values(conn.Do("XINFO", "CONSUMERS", topic, group))
+	if err != nil {
+		return nil, err
+	}
+	consumers := make([]*ConsumerInfo, 0, len(reply))
+	for _, rawConsumer := range reply {
+		// 每个消费者的信息格式为 [field, value, field, value...]
+		fields, _ := rawConsumer.([]interface{})
+		if len(fields)%2 != 0 {
+			return nil, ErrInvlidMsg
+		}
+		consumer := &ConsumerInfo{}
+		for i := 0; i < len(fields); i += 2 {
+			switch gocast.ToString(fields[i]) {
+			case "name":
+				consumer.Name = gocast.ToString(fields[i+1])
+			case "pending":
+				consumer.Pending = gocast.ToInt64(fields[i+1])
+			case "idle":
+				consumer.IdleMs = gocast.ToInt64(fields[i+1])
+			}
+		}
+		consumers = append(consumers, consumer)
+	}
+	return consumers, nil
+}
+
+// XGroupDestroy 删除消费者组，组内的消费进度和未 ack 的消息记录都会被删除，返回是否删除成功
+func (c *Client) XGroupDestroy(ctx context.Context, topic, group string) (bool, error) {
+	if topic == "" || group == "" {
+		return false, errors.New("redis XGROUP DESTROY topic | group can't be empty")
+	}
+	conn, err := c.pool.GetContext(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+	return redis.Bool(conn.Do("XGROUP", "DESTROY", topic, group))
+}
+
+// XGroupCreateConsumer 在消费者组内创建消费者，返回是否新建，消费者已存在时返回 false
+func (c *Client) XGroupCreateConsumer(ctx context.Context, topic, group, consumer string) (bool, error) {
+	if topic == "" || group == "" || consumer == "" {
+		return false, errors.New("redis XGROUP CREATECONSUMER topic | group | consumer can't be empty")
+	}
+	conn, err := c.pool.GetContext(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+	return redis.Bool(conn.Do("XGROUP", "CREATECONSUMER", topic, group, consumer))
+}
+
+// XGroupDelConsumer 从消费者组内删除消费者，返回该消费者被一并删除的未 ack 消息数量，这些消息不会再被重新投递
+func (c *Client) XGroupDelConsumer(ctx context.Context, topic, group, consumer string) (int64, error) {
+	if topic == "" || group == "" || consumer == "" {
+		return -1, errors.New("redis XGROUP DELCONSUMER topic | group | consumer can't be empty")
+	}
+	conn, err := c.pool.GetContext(ctx)
+	if err != nil {
+		return -1, err
+	}
+	defer conn.Close()
+	return redis.Int64(conn.Do("XGROUP", "DELCONSUMER", topic, group, consumer))
+}
+
+// XDel 从 stream 中删除指定消息，返回实际删除的消息数量
+func (c *Client) XDel(ctx context.Context, topic string, msgIDs ...string) (int64, error) {
+	if topic == "" || len(msgIDs) == 0 {
+		return -1, errors.New("redis XDEL topic | msg ids can't be empty")
+	}
+	conn, err := c.pool.GetContext(ctx)
+	if err != nil {
+		return -1, err
+	}
+	defer conn.Close()
+	args := []interface{}{topic}
+	for _, msgID := range msgIDs {
+		args = append(args, msgID)
+	}
+	return redis.Int64(conn.Do("XDEL", args...))
+}
+
+// Publish 向 channel 发布消息，返回收到消息的订阅者数量
+func (c *Client) Publish(ctx context.Context, channel string, data []byte) (int64, error) {
+	if channel == "" {
+		return -1, errors.New("redis PUBLISH channel can't be empty")
+	}
+	conn, err := c.pool.GetContext(ctx)
+	if err != nil {
+		return -1, err
+	}
+	defer conn.Close()
+	return redis.Int64(conn.Do("PUBLISH", channel, data))
+}
+
+// Subscribe 订阅 channels，收到消息时调用 onMessage，阻塞直到 ctx 结束或连接出错。
+// 订阅期间独占一个连接，断开期间发布的消息不会被补发
+func (c *Client) Subscribe(ctx context.Context, channels []string, onMessage func(channel string, data []byte)) error {
+	if len(channels) == 0 {
+		return errors.New("redis SUBSCRIBE channels can't be empty")
+	}
+	conn, err := c.pool.GetContext(ctx)
+	if err != nil {
+		return err
+	}
+	psc := redis.PubSubConn{Conn: conn}
+	defer psc.Close()
+	args := make([]interface{}, 0, len(channels))
+	for _, channel := range channels {
+		args = append(args, channel)
+	}
+	if err := psc.Subscribe(args...); err != nil {
+		return err
+	}
+	for {
+		switch reply := psc.ReceiveContext(ctx).(type) {
+		case redis.Message:
+			onMessage(reply.Channel, reply.Data)
+		case error:
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return reply
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package client
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"github.com/gomodule/redigo/redis"
+	"strings"
+)
+
+// LuaNowMs 获取 redis 服务端毫秒时间戳的 lua 片段，拼接在脚本开头后可以使用 now 变量，多个节点以 redis 的时钟为准
+const LuaNowMs = `
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+`
+
+// Script 可复用的 lua 脚本，创建时在本地计算 sha1
+// 执行时优先使用 EVALSHA，redis 中尚未缓存脚本（返回 NOSCRIPT）时先 SCRIPT LOAD 再重试，之后的执行都只传输 sha1
+type Script struct {
+	src string
+	sha string
+}
+
+func NewScript(src string) *Script {
+	sum := sha1.Sum([]byte(src))
+	return &Script{
+		src: src,
+		sha: hex.EncodeToString(sum[:]),
+	}
+}
+
+// Hash 返回脚本的 sha1
+func (s *Script) Hash() string {
+	return s.sha
+}
+
+// Load 将脚本缓存到 redis 中，可在启动时预先调用
+func (s *Script) Load(ctx context.Context, c *Client) error {
+	_, err := c.ScriptLoad(ctx, s.src)
+	return err
+}
+
+// Run 执行脚本并返回原始的回复
+func (s *Script) Run(ctx context.Context, c *Client, keys []string, args ...interface{}) (interface{}, error) {
+	reply, err := c.EvalSha(ctx, s.sha, keys, args...)
+	if !isNoScript(err) {
+		return reply, err
+	}
+	if err = s.Load(ctx, c); err != nil {
+		return nil, err
+	}
+	return c.EvalSha(ctx, s.sha, keys, args...)
+}
+
+func (s *Script) RunInt64(ctx context.Context, c *Client, keys []string, args ...interface{}) (int64, error) {
+	return redis.Int64(s.Run(ctx, c, keys, args...))
+}
+
+func (s *Script) RunString(ctx context.Context, c *Client, keys []string, args ...interface{}) (string, error) {
+	return redis.String(s.Run(ctx, c, keys, args...))
+}
+
+// RunBool 脚本返回 1 时为 true，返回 0 或 nil 时为 false
+func (s *Script) RunBool(ctx context.Context, c *Client, keys []string, args ...interface{}) (bool, error) {
+	reply, err := redis.Bool(s.Run(ctx, c, keys, args...))
+	if errors.Is(err, redis.ErrNil) {
+		return false, nil
+	}
+	return reply, err
+}
+
+func (s *Script) RunStrings(ctx context.Context, c *Client, keys []string, args ...interface{}) ([]string, error) {
+	return redis.Strings(s.Run(ctx, c, keys, args...))
+}
+
+func (s *Script) RunInt64s(ctx context.Context, c *Client, keys []string, args ...interface{}) ([]int64, error) {
+	return redis.Int64s(s.Run(ctx, c, keys, args...))
+}
+
+func (s *Script) RunValues(ctx context.Context, c *Client, keys []string, args ...interface{}) ([]interface{}, error) {
+	return redis.Values(s.Run(ctx, c, keys, args...))
+}
+
+func isNoScript(err error) bool {
+	var redisErr redis.Error
+	return errors.As(err, &redisErr) && strings.HasPrefix(string(redisErr), "NOSCRIPT")
+}
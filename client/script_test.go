@@ -0,0 +1,29 @@
+package client
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"testing"
+)
+
+func TestScript_Hash(t *testing.T) {
+	src := "return 1"
+	sum := sha1.Sum([]byte(src))
+	if got := NewScript(src).Hash(); got != hex.EncodeToString(sum[:]) {
+		t.Errorf("unexpected script hash: %s", got)
+	}
+}
+
+func TestScript_Run(t *testing.T) {
+	client := NewClient(network, address, password)
+	script := NewScript("redis.call('SET', KEYS[1], ARGV[1]) return redis.call('INCR', KEYS[1])")
+	reply, err := script.RunInt64(context.Background(), client, []string{"script_test"}, 10)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if reply != 11 {
+		t.Errorf("expect 11, got %d", reply)
+	}
+}
@@ -5,6 +5,7 @@ go 1.21.5
 require (
 	github.com/demdxx/gocast v1.2.0 // indirect
 	github.com/gomodule/redigo v1.9.2 // indirect
+	github.com/mattn/go-sqlite3 v1.14.33
 	github.com/pkg/errors v0.9.1 // indirect
 	go.uber.org/multierr v1.10.0 // indirect
 	go.uber.org/zap v1.27.0 // indirect
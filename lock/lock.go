@@ -0,0 +1,186 @@
+package lock
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"github.com/orormaybe/RedisMQ/client"
+	"github.com/orormaybe/RedisMQ/log"
+	mrand "math/rand"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrNotAcquired 锁已被其他持有者占用
+	ErrNotAcquired = errors.New("lock not acquired")
+	// ErrNotHeld 锁已过期或已被其他持有者占用，当前持有者不能再释放或续期
+	ErrNotHeld = errors.New("lock not held")
+)
+
+// 仅当锁的值仍为自己的 token 时才删除，避免误删其他持有者的锁
+var unlockScript = client.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+// 仅当锁的值仍为自己的 token 时才续期
+var refreshScript = client.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+return 0
+`)
+
+// Lock 基于 redis SET NX PX 实现的分布式锁，每次加锁使用随机 token 标识持有者
+type Lock struct {
+	client *client.Client
+	key    string
+	token  string
+	opts   *LockOptions
+	// 自动续期的生命周期管理
+	stopRenew context.CancelFunc
+	renewDone chan struct{}
+	// 锁丢失时关闭
+	lost     chan struct{}
+	lostOnce sync.Once
+	// 保证只释放一次
+	unlockOnce sync.Once
+}
+
+// TryLock 尝试获取锁，锁已被占用时立即返回 ErrNotAcquired
+func TryLock(ctx context.Context, rc *client.Client, key string, opts ...LockOption) (*Lock, error) {
+	if rc == nil {
+		return nil, errors.New("redis client can't be empty")
+	}
+	if key == "" {
+		return nil, errors.New("lock key can't be empty")
+	}
+	options := newLockOptions(opts...)
+	token, err := newToken()
+	if err != nil {
+		return nil, err
+	}
+	reply, err := rc.SetNXPX(ctx, key, token, options.ttl.Milliseconds())
+	if err != nil {
+		return nil, err
+	}
+	if reply != 1 {
+		return nil, ErrNotAcquired
+	}
+	l := &Lock{
+		client: rc,
+		key:    key,
+		token:  token,
+		opts:   options,
+		lost:   make(chan struct{}),
+	}
+	if options.autoRenew {
+		renewCtx, stopRenew := context.WithCancel(context.Background())
+		l.stopRenew = stopRenew
+		l.renewDone = make(chan struct{})
+		go l.renew(renewCtx)
+	}
+	return l, nil
+}
+
+// Obtain 阻塞获取锁，锁被占用时按指数退避重试，直到获取成功或 ctx 结束
+func Obtain(ctx context.Context, rc *client.Client, key string, opts ...LockOption) (*Lock, error) {
+	options := newLockOptions(opts...)
+	backoff := options.minBackoff
+	for {
+		l, err := TryLock(ctx, rc, key, opts...)
+		if !errors.Is(err, ErrNotAcquired) {
+			return l, err
+		}
+		// 加入随机抖动，避免多个等待者同时重试
+		wait := backoff/2 + time.Duration(mrand.Int63n(int64(backoff/2)+1))
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(wait):
+		}
+		if backoff *= 2; backoff > options.maxBackoff {
+			backoff = options.maxBackoff
+		}
+	}
+}
+
+func (l *Lock) Key() string {
+	return l.key
+}
+
+func (l *Lock) Token() string {
+	return l.token
+}
+
+// Lost 返回的 channel 在自动续期发现锁已丢失时关闭，持有者应尽快停止受锁保护的操作
+func (l *Lock) Lost() <-chan struct{} {
+	return l.lost
+}
+
+// Refresh 将锁的过期时间重置为 ttl
+func (l *Lock) Refresh(ctx context.Context, ttl time.Duration) error {
+	ok, err := refreshScript.RunBool(ctx, l.client, []string{l.key}, l.token, ttl.Milliseconds())
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrNotHeld
+	}
+	return nil
+}
+
+// Unlock 停止自动续期并释放锁，锁已不属于当前持有者时返回 ErrNotHeld
+func (l *Lock) Unlock(ctx context.Context) error {
+	err := ErrNotHeld
+	l.unlockOnce.Do(func() {
+		if l.stopRenew != nil {
+			l.stopRenew()
+			<-l.renewDone
+		}
+		var ok bool
+		if ok, err = unlockScript.RunBool(ctx, l.client, []string{l.key}, l.token); err == nil && !ok {
+			err = ErrNotHeld
+		}
+	})
+	return err
+}
+
+func (l *Lock) renew(ctx context.Context) {
+	defer close(l.renewDone)
+	ticker := time.NewTicker(l.opts.renewInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		tctx, cancel := context.WithTimeout(ctx, l.opts.renewInterval)
+		err := l.Refresh(tctx, l.opts.ttl)
+		cancel()
+		if errors.Is(err, ErrNotHeld) {
+			log.GetDefaultLogger().Warnf("lock lost, key: %s", l.key)
+			l.lostOnce.Do(func() {
+				close(l.lost)
+			})
+			return
+		}
+		if err != nil {
+			// 网络抖动等临时错误，下一轮继续尝试续期
+			log.GetDefaultLogger().Errorf("lock renew failed, key: %s, err: %v", l.key, err)
+		}
+	}
+}
+
+func newToken() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
@@ -0,0 +1,55 @@
+package lock
+
+import (
+	"context"
+	"errors"
+	"github.com/orormaybe/RedisMQ/client"
+	"testing"
+	"time"
+)
+
+const (
+	network  = "tcp"
+	address  = "47.96.167.87:6379"
+	password = "123456"
+)
+
+func TestLock(t *testing.T) {
+	c := client.NewClient(network, address, password)
+	l, err := TryLock(context.Background(), c, "lock_test", WithTTL(time.Second))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if _, err = TryLock(context.Background(), c, "lock_test"); !errors.Is(err, ErrNotAcquired) {
+		t.Errorf("expect ErrNotAcquired, got %v", err)
+	}
+	// 持有期间自动续期，超过 ttl 后锁仍然有效
+	<-time.After(2 * time.Second)
+	if err = l.Unlock(context.Background()); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestObtain(t *testing.T) {
+	c := client.NewClient(network, address, password)
+	l, err := TryLock(context.Background(), c, "lock_test_obtain", WithTTL(time.Second), WithAutoRenew(false))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	// 第一把锁不续期，过期后才能获取到
+	l2, err := Obtain(ctx, c, "lock_test_obtain")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if err = l.Unlock(context.Background()); !errors.Is(err, ErrNotHeld) {
+		t.Errorf("expect ErrNotHeld, got %v", err)
+	}
+	if err = l2.Unlock(context.Background()); err != nil {
+		t.Error(err)
+	}
+}
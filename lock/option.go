@@ -0,0 +1,71 @@
+package lock
+
+import "time"
+
+type LockOptions struct {
+	// 锁的过期时间
+	ttl time.Duration
+	// 是否在持有锁期间自动续期
+	autoRenew bool
+	// 自动续期的间隔，需要小于 ttl
+	renewInterval time.Duration
+	// 阻塞获取锁时，重试的最小及最大退避时长
+	minBackoff time.Duration
+	maxBackoff time.Duration
+}
+
+type LockOption func(opts *LockOptions)
+
+func WithTTL(dur time.Duration) LockOption {
+	return func(opts *LockOptions) {
+		opts.ttl = dur
+	}
+}
+
+func WithAutoRenew(enable bool) LockOption {
+	return func(opts *LockOptions) {
+		opts.autoRenew = enable
+	}
+}
+
+func WithRenewInterval(dur time.Duration) LockOption {
+	return func(opts *LockOptions) {
+		opts.renewInterval = dur
+	}
+}
+
+func WithBackoff(min, max time.Duration) LockOption {
+	return func(opts *LockOptions) {
+		opts.minBackoff = min
+		opts.maxBackoff = max
+	}
+}
+
+func newLockOptions(opts ...LockOption) *LockOptions {
+	options := &LockOptions{
+		autoRenew: true,
+	}
+	for _, opt := range opts {
+		opt(options)
+	}
+	repairLock(options)
+	return options
+}
+
+func repairLock(opts *LockOptions) {
+	if opts.ttl < time.Millisecond {
+		opts.ttl = 10 * time.Second
+	}
+
+	if opts.renewInterval <= 0 || opts.renewInterval >= opts.ttl {
+		opts.renewInterval = opts.ttl / 3
+	}
+
+	if opts.minBackoff <= 0 {
+		opts.minBackoff = 10 * time.Millisecond
+	}
+
+	if opts.maxBackoff < opts.minBackoff {
+		opts.maxBackoff = 50 * opts.minBackoff
+	}
+}
@@ -0,0 +1,81 @@
+package outbox
+
+import (
+	"fmt"
+	"time"
+)
+
+// Placeholder 返回 sql 语句中第 n 个参数的占位符，n 从 1 开始
+type Placeholder func(n int) string
+
+// Question mysql、sqlite 使用的 ? 占位符
+func Question(n int) string {
+	return "?"
+}
+
+// Dollar postgres 使用的 $n 占位符
+func Dollar(n int) string {
+	return fmt.Sprintf("$%d", n)
+}
+
+type OutboxOptions struct {
+	// sql 语句中参数的占位符
+	placeholder Placeholder
+}
+
+type OutboxOption func(opts *OutboxOptions)
+
+func WithPlaceholder(placeholder Placeholder) OutboxOption {
+	return func(opts *OutboxOptions) {
+		opts.placeholder = placeholder
+	}
+}
+
+func repairOutbox(opts *OutboxOptions) {
+	if opts.placeholder == nil {
+		opts.placeholder = Question
+	}
+}
+
+type RelayOptions struct {
+	// 轮询未投递消息的间隔
+	interval time.Duration
+	// 每批锁定并投递的消息条数
+	batchSize int
+	// 锁定的有效期，relay 异常退出时，超过有效期的消息会被其他 relay 重新锁定
+	lockTTL time.Duration
+}
+
+type RelayOption func(opts *RelayOptions)
+
+func WithInterval(dur time.Duration) RelayOption {
+	return func(opts *RelayOptions) {
+		opts.interval = dur
+	}
+}
+
+func WithBatchSize(n int) RelayOption {
+	return func(opts *RelayOptions) {
+		opts.batchSize = n
+	}
+}
+
+func WithLockTTL(dur time.Duration) RelayOption {
+	return func(opts *RelayOptions) {
+		opts.lockTTL = dur
+	}
+}
+
+func repairRelay(opts *RelayOptions) {
+	if opts.interval <= 0 {
+		opts.interval = time.Second
+	}
+
+	if opts.batchSize <= 0 {
+		opts.batchSize = 100
+	}
+
+	if opts.lockTTL <= 0 {
+		opts.lockTTL = 30 * time.Second
+	}
+}
@@ -0,0 +1,155 @@
+package outbox
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Message 写入 outbox 表、等待投递到 topic 的消息
+type Message struct {
+	Topic   string
+	Key     string
+	Val     string
+	Headers map[string]string
+}
+
+// Execer 执行 sql 语句，*sql.DB 和 *sql.Tx 都实现了此接口，通过 *sql.Tx 写入时消息与业务数据在同一个事务中提交
+type Execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+// Outbox 基于数据库表的事务性发件箱，业务数据与待投递的消息在同一个事务中写入，再由 Relay 异步投递到 topic
+type Outbox struct {
+	table string
+	opts  *OutboxOptions
+}
+
+func New(table string, opts ...OutboxOption) (*Outbox, error) {
+	if table == "" {
+		return nil, errors.New("outbox table can't be empty")
+	}
+	o := &Outbox{
+		table: table,
+		opts:  &OutboxOptions{},
+	}
+	for _, opt := range opts {
+		opt(o.opts)
+	}
+	repairOutbox(o.opts)
+	return o, nil
+}
+
+// Schema 返回 outbox 表的建表语句，只使用了 mysql、postgres、sqlite 通用的类型，重复执行不会报错；
+// mysql 不支持 CREATE INDEX IF NOT EXISTS，需要自行创建索引。
+// id 同时作为投递时的幂等键；created_at 为纳秒时间戳，同一次写入的消息依次递增，用于确定投递顺序；locked_by / locked_until 记录锁定消息的 relay 及锁定有效期；sent_at 为 0 表示尚未投递
+func (o *Outbox) Schema() []string {
+	return []string{
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	id VARCHAR(64) NOT NULL PRIMARY KEY,
+	topic VARCHAR(255) NOT NULL,
+	msg_key VARCHAR(255) NOT NULL,
+	msg_val TEXT NOT NULL,
+	headers TEXT NOT NULL,
+	created_at BIGINT NOT NULL,
+	locked_by VARCHAR(64) NOT NULL DEFAULT '',
+	locked_until BIGINT NOT NULL DEFAULT 0,
+	sent_at BIGINT NOT NULL DEFAULT 0,
+	msg_id VARCHAR(64) NOT NULL DEFAULT ''
+)`, o.table),
+		fmt.Sprintf(`CREATE INDEX IF NOT EXISTS idx_%s_unsent ON %s (sent_at, created_at)`, o.table, o.table),
+	}
+}
+
+// CreateTable 创建 outbox 表及索引
+func (o *Outbox) CreateTable(ctx context.Context, db Execer) error {
+	for _, stmt := range o.Schema() {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Enqueue 将消息写入 outbox 表，传入业务事务的 *sql.Tx 时，消息随事务一起提交或回滚
+func (o *Outbox) Enqueue(ctx context.Context, db Execer, msgs ...*Message) error {
+	now := time.Now().UnixNano()
+	for i, msg := range msgs {
+		if msg == nil || msg.Topic == "" {
+			return errors.New("outbox msg topic can't be empty")
+		}
+		id, err := newID()
+		if err != nil {
+			return err
+		}
+		headers, err := encodeHeaders(msg.Headers)
+		if err != nil {
+			return err
+		}
+		query := fmt.Sprintf("INSERT INTO %s (id, topic, msg_key, msg_val, headers, created_at) VALUES (%s)", o.table, o.placeholders(1, 6))
+		if _, err := db.ExecContext(ctx, query, id, msg.Topic, msg.Key, msg.Val, headers, now+int64(i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Purge 删除 before 之前已投递的消息，返回删除的条数
+func (o *Outbox) Purge(ctx context.Context, db Execer, before time.Time) (int64, error) {
+	query := fmt.Sprintf("DELETE FROM %s WHERE sent_at > 0 AND sent_at < %s", o.table, o.ph(1))
+	res, err := db.ExecContext(ctx, query, before.UnixMilli())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// 返回第 n 个参数的占位符
+func (o *Outbox) ph(n int) string {
+	return o.opts.placeholder(n)
+}
+
+// 返回第 from 个开始的 cnt 个参数的占位符，以逗号分隔
+func (o *Outbox) placeholders(from, cnt int) string {
+	phs := make([]string, 0, cnt)
+	for i := 0; i < cnt; i++ {
+		phs = append(phs, o.ph(from+i))
+	}
+	return strings.Join(phs, ", ")
+}
+
+func encodeHeaders(headers map[string]string) (string, error) {
+	if len(headers) == 0 {
+		return "", nil
+	}
+	raw, err := json.Marshal(headers)
+	if err != nil {
+		return "", err
+	}
+	return string(raw), nil
+}
+
+func decodeHeaders(raw string) (map[string]string, error) {
+	if raw == "" {
+		return nil, nil
+	}
+	var headers map[string]string
+	if err := json.Unmarshal([]byte(raw), &headers); err != nil {
+		return nil, err
+	}
+	return headers, nil
+}
+
+func newID() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
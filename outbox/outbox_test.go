@@ -0,0 +1,129 @@
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	_ "github.com/mattn/go-sqlite3"
+	"testing"
+	"time"
+)
+
+type publishedMsg struct {
+	topic    string
+	dedupKey string
+	key      string
+	val      string
+}
+
+type fakePublisher struct {
+	published []publishedMsg
+	// 投递第 failAt 条消息时返回错误，从 1 开始，0 表示不失败
+	failAt int
+}
+
+func (p *fakePublisher) SendMsgIdempotent(ctx context.Context, topic, dedupKey, key, val string) (string, bool, error) {
+	if p.failAt > 0 && len(p.published)+1 == p.failAt {
+		p.failAt = 0
+		return "", false, errors.New("publish failed")
+	}
+	p.published = append(p.published, publishedMsg{topic: topic, dedupKey: dedupKey, key: key, val: val})
+	return fmt.Sprintf("%d-0", len(p.published)), false, nil
+}
+
+func newTestOutbox(t *testing.T) (*sql.DB, *Outbox) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 内存数据库的每个连接相互独立
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+	o, err := New("mq_outbox")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 重复启动时再次建表不应报错
+	for i := 0; i < 2; i++ {
+		if err := o.CreateTable(context.Background(), db); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return db, o
+}
+
+func TestOutbox_Enqueue(t *testing.T) {
+	db, o := newTestOutbox(t)
+	ctx := context.Background()
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := o.Enqueue(ctx, tx, &Message{Topic: "test40", Key: "k1", Val: "v1"}); err != nil {
+		t.Fatal(err)
+	}
+	tx.Rollback()
+	var cnt int
+	if err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM mq_outbox").Scan(&cnt); err != nil || cnt != 0 {
+		t.Errorf("rolled back msg should not be written, cnt: %d, err: %v", cnt, err)
+	}
+	if err := o.Enqueue(ctx, db, &Message{Topic: ""}); err == nil {
+		t.Error("enqueue msg without topic should fail")
+	}
+}
+
+func TestRelay_RelayOnce(t *testing.T) {
+	db, o := newTestOutbox(t)
+	ctx := context.Background()
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msgs := []*Message{
+		{Topic: "test40", Key: "k1", Val: "v1", Headers: map[string]string{"h1": "v1"}},
+		{Topic: "test40", Key: "k2", Val: "v2"},
+		{Topic: "test41", Key: "k3", Val: "v3"},
+	}
+	if err := o.Enqueue(ctx, tx, msgs...); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	publisher := &fakePublisher{failAt: 2}
+	r, err := NewRelay(db, o, publisher, WithInterval(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Stop()
+	<-r.Done()
+	sent, err := r.RelayOnce(ctx)
+	if err == nil || sent != 1 {
+		t.Errorf("expect 1 msg sent before failure, sent: %d, err: %v", sent, err)
+	}
+	// 失败后剩余的消息解除锁定，下一轮按顺序继续投递
+	if sent, err = r.RelayOnce(ctx); err != nil || sent != 2 {
+		t.Errorf("expect 2 msgs sent, sent: %d, err: %v", sent, err)
+	}
+	if sent, err = r.RelayOnce(ctx); err != nil || sent != 0 {
+		t.Errorf("expect no msg left, sent: %d, err: %v", sent, err)
+	}
+	if len(publisher.published) != 3 {
+		t.Fatalf("unexpected published msgs: %v", publisher.published)
+	}
+	for i, msg := range publisher.published {
+		if msg.key != msgs[i].Key || msg.topic != msgs[i].Topic || msg.dedupKey == "" {
+			t.Errorf("unexpected published msg: %v", msg)
+		}
+	}
+
+	var msgID string
+	if err := db.QueryRowContext(ctx, "SELECT msg_id FROM mq_outbox WHERE msg_key = 'k3'").Scan(&msgID); err != nil || msgID != "3-0" {
+		t.Errorf("unexpected msg id: %s, err: %v", msgID, err)
+	}
+	if purged, err := o.Purge(ctx, db, time.Now().Add(time.Minute)); err != nil || purged != 3 {
+		t.Errorf("expect 3 msgs purged, purged: %d, err: %v", purged, err)
+	}
+}
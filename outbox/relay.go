@@ -0,0 +1,227 @@
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/orormaybe/RedisMQ/MQ"
+	"github.com/orormaybe/RedisMQ/log"
+	"time"
+)
+
+// Publisher 投递消息，*MQ.Producer 实现了此接口。以 dedupKey 幂等投递，relay 重复投递同一条消息时不会产生新消息
+type Publisher interface {
+	SendMsgIdempotent(ctx context.Context, topic, dedupKey, key, val string) (msgID string, duplicated bool, err error)
+}
+
+var _ Publisher = (*MQ.Producer)(nil)
+
+// 锁定后等待投递的消息
+type pendingMsg struct {
+	id string
+	Message
+}
+
+// Relay 定期锁定 outbox 表中尚未投递的消息，按写入顺序投递到 topic 后标记为已投递。
+// 多个 relay 可以同时运行，每条消息同一时间只会被一个 relay 锁定，但不同 relay 锁定的批次会并发投递，
+// 此时不再保证消息之间的投递顺序，需要严格按写入顺序投递时只运行一个 relay；relay 在投递后、标记前异常退出时，
+// 消息会在锁定过期后被重新投递，依靠 Publisher 的幂等投递去重
+type Relay struct {
+	db        *sql.DB
+	outbox    *Outbox
+	publisher Publisher
+	// 生命周期管理
+	ctx  context.Context
+	stop context.CancelFunc
+	// 当前 relay 的 id，记录在锁定的消息上
+	relayID string
+	opts    *RelayOptions
+	// 投递流程退出时关闭
+	done chan struct{}
+}
+
+func NewRelay(db *sql.DB, outbox *Outbox, publisher Publisher, opts ...RelayOption) (*Relay, error) {
+	if db == nil || outbox == nil || publisher == nil {
+		return nil, errors.New("db | outbox | publisher can't be empty")
+	}
+	relayID, err := newID()
+	if err != nil {
+		return nil, err
+	}
+	ctx, stop := context.WithCancel(context.Background())
+	r := &Relay{
+		db:        db,
+		outbox:    outbox,
+		publisher: publisher,
+		ctx:       ctx,
+		stop:      stop,
+		relayID:   relayID,
+		opts:      &RelayOptions{},
+		done:      make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(r.opts)
+	}
+	repairRelay(r.opts)
+	go r.run()
+	return r, nil
+}
+
+func (r *Relay) Stop() {
+	r.stop()
+}
+
+// Done 返回的 channel 在投递流程退出时关闭
+func (r *Relay) Done() <-chan struct{} {
+	return r.done
+}
+
+func (r *Relay) run() {
+	defer close(r.done)
+	ticker := time.NewTicker(r.opts.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		// 一批投递满时说明还有积压，立即处理下一批
+		for r.ctx.Err() == nil {
+			sent, err := r.RelayOnce(r.ctx)
+			if err != nil {
+				if r.ctx.Err() == nil {
+					log.GetDefaultLogger().Errorf("outbox relay failed, relay id: %s, err: %v", r.relayID, err)
+				}
+				break
+			}
+			if sent < r.opts.batchSize {
+				break
+			}
+		}
+	}
+}
+
+// RelayOnce 锁定一批尚未投递的消息并依次投递，返回成功投递的条数。
+// 某条消息投递失败时停止投递本批剩余的消息并解除锁定，保证本批消息按写入顺序投递
+func (r *Relay) RelayOnce(ctx context.Context) (int, error) {
+	msgs, err := r.lock(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if len(msgs) == 0 {
+		return 0, nil
+	}
+	var sent []string
+	var msgIDs []string
+	var publishErr error
+	for _, msg := range msgs {
+		msgID, _, err := r.publisher.SendMsgIdempotent(MQ.ContextWithHeaders(ctx, msg.Headers), msg.Topic, msg.id, msg.Key, msg.Val)
+		if err != nil {
+			publishErr = fmt.Errorf("outbox msg publish failed, id: %s, topic: %s: %w", msg.id, msg.Topic, err)
+			break
+		}
+		sent = append(sent, msg.id)
+		msgIDs = append(msgIDs, msgID)
+	}
+	// 使用独立的 context，避免停止时已投递的消息无法标记
+	mctx, cancel := context.WithTimeout(context.Background(), r.opts.lockTTL)
+	defer cancel()
+	if err := r.markSent(mctx, sent, msgIDs); err != nil {
+		return 0, err
+	}
+	if publishErr != nil {
+		if err := r.unlock(mctx); err != nil {
+			log.GetDefaultLogger().Errorf("outbox msgs unlock failed, relay id: %s, err: %v", r.relayID, err)
+		}
+		return len(sent), publishErr
+	}
+	return len(sent), nil
+}
+
+// 锁定一批尚未投递且未被其他 relay 锁定的消息，返回当前 relay 锁定的消息
+func (r *Relay) lock(ctx context.Context) ([]*pendingMsg, error) {
+	o := r.outbox
+	now := time.Now()
+	query := fmt.Sprintf("SELECT id FROM %s WHERE sent_at = 0 AND locked_until < %s ORDER BY created_at, id LIMIT %d", o.table, o.ph(1), r.opts.batchSize)
+	rows, err := r.db.QueryContext(ctx, query, now.UnixMilli())
+	if err != nil {
+		return nil, err
+	}
+	var ids []any
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	// 条件中再次检查锁定状态，多个 relay 同时锁定同一条消息时只有一个能成功
+	lockedUntil := now.Add(r.opts.lockTTL).UnixMilli()
+	query = fmt.Sprintf("UPDATE %s SET locked_by = %s, locked_until = %s WHERE sent_at = 0 AND locked_until < %s AND id IN (%s)",
+		o.table, o.ph(1), o.ph(2), o.ph(3), o.placeholders(4, len(ids)))
+	args := append([]any{r.relayID, lockedUntil, now.UnixMilli()}, ids...)
+	if _, err := r.db.ExecContext(ctx, query, args...); err != nil {
+		return nil, err
+	}
+
+	query = fmt.Sprintf("SELECT id, topic, msg_key, msg_val, headers FROM %s WHERE sent_at = 0 AND locked_by = %s AND locked_until = %s ORDER BY created_at, id",
+		o.table, o.ph(1), o.ph(2))
+	rows, err = r.db.QueryContext(ctx, query, r.relayID, lockedUntil)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var msgs []*pendingMsg
+	for rows.Next() {
+		msg := &pendingMsg{}
+		var headers string
+		if err := rows.Scan(&msg.id, &msg.Topic, &msg.Key, &msg.Val, &headers); err != nil {
+			return nil, err
+		}
+		if msg.Headers, err = decodeHeaders(headers); err != nil {
+			return nil, err
+		}
+		msgs = append(msgs, msg)
+	}
+	return msgs, rows.Err()
+}
+
+// 在同一个事务中将已投递的消息标记为已投递，并记录投递后的消息 id
+func (r *Relay) markSent(ctx context.Context, ids, msgIDs []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	o := r.outbox
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	query := fmt.Sprintf("UPDATE %s SET sent_at = %s, msg_id = %s, locked_until = 0 WHERE id = %s AND locked_by = %s", o.table, o.ph(1), o.ph(2), o.ph(3), o.ph(4))
+	now := time.Now().UnixMilli()
+	for i, id := range ids {
+		if _, err := tx.ExecContext(ctx, query, now, msgIDs[i], id, r.relayID); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// 解除当前 relay 对尚未投递消息的锁定，以便下一轮重新投递
+func (r *Relay) unlock(ctx context.Context) error {
+	o := r.outbox
+	query := fmt.Sprintf("UPDATE %s SET locked_until = 0 WHERE sent_at = 0 AND locked_by = %s", o.table, o.ph(1))
+	_, err := r.db.ExecContext(ctx, query, r.relayID)
+	return err
+}
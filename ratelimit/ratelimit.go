@@ -0,0 +1,259 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/orormaybe/RedisMQ/client"
+	"time"
+)
+
+// ErrExceedsLimit 单次申请的配额超过限流器的上限，永远无法放行
+var ErrExceedsLimit = errors.New("rate limit n exceeds limit")
+
+// Result 一次限流判断的结果
+type Result struct {
+	// 是否放行
+	Allowed bool
+	// 剩余的配额
+	Remaining int64
+	// 未放行时，距离下一次可能放行需要等待的时长
+	RetryAfter time.Duration
+}
+
+// Limiter 基于 redis lua 脚本实现的分布式限流器，所有使用同一个 key 的节点共享配额
+type Limiter interface {
+	// AllowN 尝试一次性获取 n 个配额，未放行时不消耗配额
+	AllowN(ctx context.Context, key string, n int) (*Result, error)
+}
+
+// Allow 尝试获取 1 个配额
+func Allow(ctx context.Context, l Limiter, key string) (bool, error) {
+	res, err := l.AllowN(ctx, key, 1)
+	if err != nil {
+		return false, err
+	}
+	return res.Allowed, nil
+}
+
+// Wait 阻塞直到获取 1 个配额，或 ctx 结束
+func Wait(ctx context.Context, l Limiter, key string) error {
+	for {
+		res, err := l.AllowN(ctx, key, 1)
+		if err != nil {
+			return err
+		}
+		if res.Allowed {
+			return nil
+		}
+		retryAfter := res.RetryAfter
+		if retryAfter <= 0 {
+			retryAfter = 10 * time.Millisecond
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(retryAfter):
+		}
+	}
+}
+
+// Bound 绑定了固定 key 的限流器，可直接作为 MQ.RateLimiter 使用
+type Bound struct {
+	limiter Limiter
+	key     string
+}
+
+func Bind(l Limiter, key string) *Bound {
+	return &Bound{
+		limiter: l,
+		key:     key,
+	}
+}
+
+func (b *Bound) Wait(ctx context.Context) error {
+	return Wait(ctx, b.limiter, b.key)
+}
+
+// 限流脚本统一返回 {是否放行, 剩余配额, 需要等待的毫秒数}
+func runResult(ctx context.Context, rc *client.Client, script *client.Script, keys []string, args ...interface{}) (*Result, error) {
+	reply, err := script.RunInt64s(ctx, rc, keys, args...)
+	if err != nil {
+		return nil, err
+	}
+	if len(reply) != 3 {
+		return nil, fmt.Errorf("invalid reply: %v", reply)
+	}
+	return &Result{
+		Allowed:    reply[0] == 1,
+		Remaining:  reply[1],
+		RetryAfter: time.Duration(reply[2]) * time.Millisecond,
+	}, nil
+}
+
+func checkParam(rc *client.Client, key string, n int) error {
+	if rc == nil {
+		return errors.New("redis client can't be empty")
+	}
+	if key == "" {
+		return errors.New("rate limit key can't be empty")
+	}
+	if n <= 0 {
+		return errors.New("rate limit n must be positive")
+	}
+	return nil
+}
+
+// 固定窗口计数：KEYS[1] 计数 key，ARGV[1] 窗口内配额，ARGV[2] 窗口毫秒数，ARGV[3] 本次申请的配额
+var fixedWindowScript = client.NewScript(`
+local limit = tonumber(ARGV[1])
+local n = tonumber(ARGV[3])
+local cnt = redis.call('INCRBY', KEYS[1], n)
+if cnt == n then
+	redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+if cnt > limit then
+	redis.call('DECRBY', KEYS[1], n)
+	local ttl = redis.call('PTTL', KEYS[1])
+	if ttl < 0 then
+		ttl = tonumber(ARGV[2])
+	end
+	return {0, limit - cnt + n, ttl}
+end
+return {1, limit - cnt, 0}
+`)
+
+// FixedWindow 固定窗口限流，每个窗口内最多放行 limit 个配额，实现简单但窗口边界处可能出现两倍突发
+type FixedWindow struct {
+	client *client.Client
+	limit  int
+	window time.Duration
+}
+
+func NewFixedWindow(rc *client.Client, limit int, window time.Duration) (*FixedWindow, error) {
+	if limit <= 0 || window <= 0 {
+		return nil, errors.New("fixed window limit and window must be positive")
+	}
+	return &FixedWindow{
+		client: rc,
+		limit:  limit,
+		window: window,
+	}, nil
+}
+
+func (l *FixedWindow) AllowN(ctx context.Context, key string, n int) (*Result, error) {
+	if err := checkParam(l.client, key, n); err != nil {
+		return nil, err
+	}
+	if n > l.limit {
+		return nil, ErrExceedsLimit
+	}
+	return runResult(ctx, l.client, fixedWindowScript, []string{key}, l.limit, l.window.Milliseconds(), n)
+}
+
+// 滑动窗口日志：KEYS[1] 记录放行时间的有序集合，ARGV[1] 窗口内配额，ARGV[2] 窗口毫秒数，ARGV[3] 本次申请的配额
+var slidingWindowLogScript = client.NewScript(client.LuaNowMs + `
+local limit = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local n = tonumber(ARGV[3])
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', now - window)
+local cnt = redis.call('ZCARD', KEYS[1])
+if cnt + n > limit then
+	local retry = window
+	local oldest = redis.call('ZRANGE', KEYS[1], 0, 0, 'WITHSCORES')
+	if #oldest > 0 then
+		retry = tonumber(oldest[2]) + window - now
+	end
+	return {0, limit - cnt, retry}
+end
+local seq = redis.call('INCR', KEYS[1] .. ':seq')
+redis.call('PEXPIRE', KEYS[1] .. ':seq', window)
+for i = 1, n do
+	redis.call('ZADD', KEYS[1], now, seq .. ':' .. i)
+end
+redis.call('PEXPIRE', KEYS[1], window)
+return {1, limit - cnt - n, 0}
+`)
+
+// SlidingWindowLog 滑动窗口日志限流，记录窗口内每次放行的时间，任意 window 时长内最多放行 limit 个配额
+// 精确但需要为每个配额保存一条记录，适合配额较小的场景
+type SlidingWindowLog struct {
+	client *client.Client
+	limit  int
+	window time.Duration
+}
+
+func NewSlidingWindowLog(rc *client.Client, limit int, window time.Duration) (*SlidingWindowLog, error) {
+	if limit <= 0 || window <= 0 {
+		return nil, errors.New("sliding window log limit and window must be positive")
+	}
+	return &SlidingWindowLog{
+		client: rc,
+		limit:  limit,
+		window: window,
+	}, nil
+}
+
+func (l *SlidingWindowLog) AllowN(ctx context.Context, key string, n int) (*Result, error) {
+	if err := checkParam(l.client, key, n); err != nil {
+		return nil, err
+	}
+	if n > l.limit {
+		return nil, ErrExceedsLimit
+	}
+	return runResult(ctx, l.client, slidingWindowLogScript, []string{key}, l.limit, l.window.Milliseconds(), n)
+}
+
+// 令牌桶：KEYS[1] 保存令牌数及上次更新时间的哈希，ARGV[1] 每秒生成的令牌数，ARGV[2] 桶容量，ARGV[3] 本次申请的令牌数
+var tokenBucketScript = client.NewScript(client.LuaNowMs + `
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local n = tonumber(ARGV[3])
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(state[1])
+local ts = tonumber(state[2])
+if tokens == nil or ts == nil then
+	tokens = burst
+	ts = now
+end
+tokens = math.min(burst, tokens + math.max(0, now - ts) * rate / 1000)
+local allowed = 0
+local retry = 0
+if tokens >= n then
+	tokens = tokens - n
+	allowed = 1
+else
+	retry = math.ceil((n - tokens) * 1000 / rate)
+end
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'ts', now)
+redis.call('PEXPIRE', KEYS[1], math.ceil(burst * 1000 / rate) + 1000)
+return {allowed, math.floor(tokens), retry}
+`)
+
+// TokenBucket 令牌桶限流，以 rate 个每秒的速度生成令牌，最多累积 burst 个，允许一定程度的突发
+type TokenBucket struct {
+	client *client.Client
+	rate   float64
+	burst  int
+}
+
+func NewTokenBucket(rc *client.Client, ratePerSecond float64, burst int) (*TokenBucket, error) {
+	if ratePerSecond <= 0 || burst <= 0 {
+		return nil, errors.New("token bucket rate and burst must be positive")
+	}
+	return &TokenBucket{
+		client: rc,
+		rate:   ratePerSecond,
+		burst:  burst,
+	}, nil
+}
+
+func (l *TokenBucket) AllowN(ctx context.Context, key string, n int) (*Result, error) {
+	if err := checkParam(l.client, key, n); err != nil {
+		return nil, err
+	}
+	if n > l.burst {
+		return nil, ErrExceedsLimit
+	}
+	return runResult(ctx, l.client, tokenBucketScript, []string{key}, l.rate, l.burst, n)
+}
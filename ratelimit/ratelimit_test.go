@@ -0,0 +1,72 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"github.com/orormaybe/RedisMQ/client"
+	"testing"
+	"time"
+)
+
+const (
+	network  = "tcp"
+	address  = "47.96.167.87:6379"
+	password = "123456"
+)
+
+func TestLimiters(t *testing.T) {
+	c := client.NewClient(network, address, password)
+	fixedWindow, _ := NewFixedWindow(c, 3, time.Second)
+	slidingWindowLog, _ := NewSlidingWindowLog(c, 3, time.Second)
+	tokenBucket, _ := NewTokenBucket(c, 3, 3)
+	limiters := map[string]Limiter{
+		"fixed_window":       fixedWindow,
+		"sliding_window_log": slidingWindowLog,
+		"token_bucket":       tokenBucket,
+	}
+	for name, limiter := range limiters {
+		key := "ratelimit_test:" + name
+		var allowed int
+		for i := 0; i < 5; i++ {
+			res, err := limiter.AllowN(context.Background(), key, 1)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if res.Allowed {
+				allowed++
+			}
+		}
+		if allowed != 3 {
+			t.Errorf("%s: expect 3 allowed, got %d", name, allowed)
+		}
+		start := time.Now()
+		if err := Wait(context.Background(), limiter, key); err != nil {
+			t.Error(err)
+			return
+		}
+		t.Logf("%s: wait cost %v", name, time.Since(start))
+	}
+}
+
+func TestLimiters_InvalidParam(t *testing.T) {
+	c := client.NewClient(network, address, password)
+	if _, err := NewFixedWindow(c, 0, time.Second); err == nil {
+		t.Error("non-positive limit should fail")
+	}
+	if _, err := NewSlidingWindowLog(c, 3, 0); err == nil {
+		t.Error("non-positive window should fail")
+	}
+	if _, err := NewTokenBucket(c, 0, 3); err == nil {
+		t.Error("non-positive rate should fail")
+	}
+	limiter, err := NewFixedWindow(c, 3, time.Second)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	// 超过上限的申请在访问 redis 之前直接失败，不会一直等待
+	if _, err := limiter.AllowN(context.Background(), "ratelimit_test:exceeds", 4); !errors.Is(err, ErrExceedsLimit) {
+		t.Errorf("expect ErrExceedsLimit, got %v", err)
+	}
+}